@@ -0,0 +1,239 @@
+package jantar
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defines the formats supported by the AccessLog middleware
+const (
+	AccessLogCommon   = iota
+	AccessLogCombined = iota
+	AccessLogLogfmt   = iota
+	AccessLogJSON     = iota
+)
+
+// AccessLogConfig configures the AccessLog middleware
+type AccessLogConfig struct {
+	// Format is one of AccessLogCommon, AccessLogCombined, AccessLogLogfmt or AccessLogJSON. Defaults to AccessLogCommon
+	Format int
+	// Output receives one line per request. Defaults to os.Stdout
+	Output io.Writer
+}
+
+// AccessLog is a Middleware that writes one line per request including the status code, response size,
+// client ip and duration. Requests rejected by jantar itself are logged as well
+type AccessLog struct {
+	Middleware
+	config *AccessLogConfig
+	mutex  sync.Mutex
+}
+
+// accessLogEntry holds all information about a finished request
+type accessLogEntry struct {
+	Time      time.Time     `json:"time"`
+	RemoteIP  string        `json:"remote_ip"`
+	User      string        `json:"user,omitempty"`
+	Method    string        `json:"method"`
+	URI       string        `json:"uri"`
+	Proto     string        `json:"proto"`
+	Status    int           `json:"status"`
+	Size      int64         `json:"size"`
+	Duration  time.Duration `json:"-"`
+	Referer   string        `json:"referer,omitempty"`
+	UserAgent string        `json:"user_agent,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// NewAccessLog creates a new access log Middleware. A nil config uses the default settings
+func NewAccessLog(config *AccessLogConfig) *AccessLog {
+	if config == nil {
+		config = &AccessLogConfig{}
+	}
+
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+
+	return &AccessLog{config: config}
+}
+
+// Outer implements the IOuterMiddleware interface
+func (a *AccessLog) Outer() {}
+
+// Wrap implements the IHandlerMiddleware interface
+// Note: Do not call this yourself
+func (a *AccessLog) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respw http.ResponseWriter, req *http.Request) {
+		t0 := time.Now()
+		rw := newResponseWriter(respw)
+
+		// the path might be changed by the router e.g. by stripping the locale prefix
+		uri := req.RequestURI
+		if uri == "" {
+			uri = req.URL.RequestURI()
+		}
+
+		next.ServeHTTP(rw, req)
+
+		a.write(&accessLogEntry{
+			Time:      t0,
+			RemoteIP:  ClientIP(req),
+			User:      principalName(req),
+			Method:    req.Method,
+			URI:       uri,
+			Proto:     req.Proto,
+			Status:    rw.Status(),
+			Size:      rw.Size(),
+			Duration:  time.Since(t0),
+			Referer:   req.Referer(),
+			UserAgent: req.UserAgent(),
+			RequestID: GetRequestID(req),
+		})
+	})
+}
+
+func (a *AccessLog) write(entry *accessLogEntry) {
+	var line []byte
+
+	switch a.config.Format {
+	case AccessLogCombined:
+		line = formatCombined(entry)
+	case AccessLogLogfmt:
+		line = formatLogfmt(entry)
+	case AccessLogJSON:
+		line = formatJSON(entry)
+	default:
+		line = formatCommon(entry)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, err := a.config.Output.Write(line); err != nil {
+		Log.Warningd(JLData{"error": err}, "failed to write access log")
+	}
+}
+
+// principalName returns the name of the principal authenticated by the Auth Middleware. Unverified credentials
+// like the user of a Basic Authorization header that has not been checked are never logged
+func principalName(req *http.Request) string {
+	switch principal := GetPrincipal(req).(type) {
+	case string:
+		return principal
+	case fmt.Stringer:
+		return principal.String()
+	}
+	return ""
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatCommon formats an entry in the Common Log Format
+func formatCommon(entry *accessLogEntry) []byte {
+	var buf bytes.Buffer
+
+	writeCommon(&buf, entry)
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+// formatCombined formats an entry in the Combined Log Format
+func formatCombined(entry *accessLogEntry) []byte {
+	var buf bytes.Buffer
+
+	writeCommon(&buf, entry)
+	buf.WriteString(" \"" + escapeQuotes(dashIfEmpty(entry.Referer)) + "\"")
+	buf.WriteString(" \"" + escapeQuotes(dashIfEmpty(entry.UserAgent)) + "\"\n")
+
+	return buf.Bytes()
+}
+
+func writeCommon(buf *bytes.Buffer, entry *accessLogEntry) {
+	size := "-"
+	if entry.Size > 0 {
+		size = strconv.FormatInt(entry.Size, 10)
+	}
+
+	buf.WriteString(dashIfEmpty(entry.RemoteIP))
+	buf.WriteString(" - ")
+	buf.WriteString(dashIfEmpty(entry.User))
+	buf.WriteString(" [" + entry.Time.Format("02/Jan/2006:15:04:05 -0700") + "] ")
+	buf.WriteString("\"" + escapeQuotes(entry.Method+" "+entry.URI+" "+entry.Proto) + "\" ")
+	buf.WriteString(strconv.Itoa(entry.Status) + " " + size)
+}
+
+// formatLogfmt formats an entry as key=value pairs
+func formatLogfmt(entry *accessLogEntry) []byte {
+	var buf bytes.Buffer
+
+	pairs := []struct {
+		key   string
+		value string
+	}{
+		{"time", entry.Time.Format(time.RFC3339)},
+		{"remote_ip", entry.RemoteIP},
+		{"user", entry.User},
+		{"method", entry.Method},
+		{"uri", entry.URI},
+		{"proto", entry.Proto},
+		{"status", strconv.Itoa(entry.Status)},
+		{"size", strconv.FormatInt(entry.Size, 10)},
+		{"duration", entry.Duration.String()},
+		{"referer", entry.Referer},
+		{"user_agent", entry.UserAgent},
+		{"request_id", entry.RequestID},
+	}
+
+	for i, pair := range pairs {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(pair.key + "=" + logfmtValue(pair.value))
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\\") || strings.IndexFunc(value, func(r rune) bool { return r < 0x20 }) != -1 {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// formatJSON formats an entry as a single line json object
+func formatJSON(entry *accessLogEntry) []byte {
+	data, err := json.Marshal(struct {
+		*accessLogEntry
+		Duration float64 `json:"duration_ms"`
+	}{entry, float64(entry.Duration) / float64(time.Millisecond)})
+
+	if err != nil {
+		Log.Warningd(JLData{"error": err}, "failed to encode access log entry")
+		return nil
+	}
+
+	return append(data, '\n')
+}
+
+// escapeQuotes escapes quotes, backslashes and control characters in quoted log fields
+func escapeQuotes(s string) string {
+	quoted := strconv.Quote(s)
+	return quoted[1 : len(quoted)-1]
+}
@@ -0,0 +1,138 @@
+package jantar
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLog(t *testing.T) {
+	var out bytes.Buffer
+
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	for format, expected := range map[int]string{
+		AccessLogCommon:   `192.0.2.1 - - [`,
+		AccessLogCombined: `"GET /hello?a=1 HTTP/1.1" 200 5 "-" "test \"agent\""`,
+		AccessLogLogfmt:   `method=GET uri="/hello?a=1" proto=HTTP/1.1 status=200 size=5`,
+	} {
+		out.Reset()
+
+		j := setupServer(false)
+		j.AddMiddleware(NewAccessLog(&AccessLogConfig{Format: format, Output: &out}))
+		j.AddRoute("GET", "/hello", helloHandler)
+
+		rw, req := testRequest("GET", "/hello?a=1")
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.RequestURI = "/hello?a=1"
+		req.Header.Set("User-Agent", `test "agent"`)
+		j.ServeHTTP(rw, req)
+
+		if !strings.Contains(out.String(), expected) || !strings.HasSuffix(out.String(), "\n") {
+			t.Errorf("Expected log line to contain '%s', got '%s'.", expected, out.String())
+		}
+	}
+
+	/* json format records the status of error handlers */
+	out.Reset()
+
+	j := setupServer(false)
+	j.AddMiddleware(NewAccessLog(&AccessLogConfig{Format: AccessLogJSON, Output: &out}))
+
+	rw, req := testRequest("GET", "/missing")
+	req.RemoteAddr = "192.0.2.1:1234"
+	j.ServeHTTP(rw, req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(float64(http.StatusNotFound), entry["status"])
+	assertEqual("192.0.2.1", entry["remote_ip"])
+	assertEqual("/missing", entry["uri"])
+}
+
+func TestAccessLogUser(t *testing.T) {
+	var out bytes.Buffer
+
+	j := setupServer(false)
+	j.AddMiddleware(NewAccessLog(&AccessLogConfig{Output: &out}))
+	j.AddMiddleware(NewAuth(&AuthConfig{Basic: BasicAuthUsers(map[string]string{"admin": "secret"})}))
+	j.AddRoute("GET", "/", helloHandler)
+
+	/* only authenticated users are logged */
+	for credentials, expected := range map[string]string{
+		"admin:secret": `192.0.2.1 - admin [`,
+		"admin:wrong":  `192.0.2.1 - - [`,
+		"forged:user":  `192.0.2.1 - - [`,
+	} {
+		out.Reset()
+
+		rw, req := testRequest("GET", "/")
+		req.RemoteAddr = "192.0.2.1:1234"
+		parts := strings.SplitN(credentials, ":", 2)
+		req.SetBasicAuth(parts[0], parts[1])
+		j.ServeHTTP(rw, req)
+
+		if !strings.HasPrefix(out.String(), expected) {
+			t.Errorf("Expected log line to start with '%s', got '%s'.", expected, out.String())
+		}
+	}
+}
+
+func TestAccessLogRejected(t *testing.T) {
+	var out bytes.Buffer
+
+	j := setupServer(true)
+	j.AddMiddleware(NewAccessLog(&AccessLogConfig{Format: AccessLogJSON, Output: &out}))
+	j.AddMiddleware(NewRequestID(nil))
+	j.AddRoute("POST", "/", helloHandler)
+	j.AddRoute("PUT", "/", helloHandler).MaxBodySize(8)
+	j.AddRoute("GET", "/slow", func(rw http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		rw.WriteHeader(http.StatusOK)
+	}).Timeout(10 * time.Millisecond)
+
+	/* responses of jantar itself are logged with their status and request id */
+	for _, test := range []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"POST", "/", "", http.StatusBadRequest},
+		{"PUT", "/", "0123456789", http.StatusRequestEntityTooLarge},
+		{"GET", "/slow", "", http.StatusServiceUnavailable},
+	} {
+		out.Reset()
+
+		rw, req := testRequest(test.method, test.path)
+		if test.body != "" {
+			req, _ = http.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		}
+		j.ServeHTTP(rw, req)
+		j.wg.Wait()
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if entry["status"] != float64(test.status) || rw.Code != test.status {
+			t.Errorf("Expected %v, got %v and logged %v.", test.status, rw.Code, entry["status"])
+		}
+
+		if id := rw.Header().Get("X-Request-ID"); id == "" || entry["request_id"] != id {
+			t.Errorf("Expected request id %v, got %v.", id, entry["request_id"])
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package jantar
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"github.com/tsurai/jantar/context"
+	"net/http"
+	"strings"
+)
+
+// AuthConfig configures the Auth middleware. At least one verifier has to be set. Verifiers return the
+// authenticated principal, e.g. a user struct, and whether the credentials are valid
+type AuthConfig struct {
+	// Realm is sent in the WWW-Authenticate header. Defaults to "Restricted"
+	Realm string
+	// Basic verifies HTTP Basic credentials. See BasicAuthUsers for a constant-time implementation
+	Basic func(user string, password string) (interface{}, bool)
+	// Bearer verifies tokens of the Authorization header with the Bearer scheme
+	Bearer func(token string) (interface{}, bool)
+	// APIKey verifies keys sent in the APIKeyHeader
+	APIKey func(key string) (interface{}, bool)
+	// APIKeyHeader defaults to "X-API-Key"
+	APIKeyHeader string
+	// Optional lets requests without credentials pass without a principal. Invalid credentials are still rejected
+	Optional bool
+}
+
+// Auth is a Middleware that authenticates requests with HTTP Basic, Bearer tokens or API keys. Requests
+// without valid credentials are answered with 401 unauthorized
+type Auth struct {
+	Middleware
+	config *AuthConfig
+}
+
+// NewAuth creates a new authentication Middleware
+func NewAuth(config *AuthConfig) *Auth {
+	if config == nil || (config.Basic == nil && config.Bearer == nil && config.APIKey == nil) {
+		Log.Fatal("auth middleware needs at least one verifier")
+	}
+
+	if config.Realm == "" {
+		config.Realm = "Restricted"
+	}
+
+	if config.APIKeyHeader == "" {
+		config.APIKeyHeader = "X-API-Key"
+	}
+
+	return &Auth{config: config}
+}
+
+// BasicAuthUsers returns a verifier for AuthConfig.Basic that checks a map of user names and passwords.
+// Passwords are compared in constant time and the user name is returned as principal
+func BasicAuthUsers(users map[string]string) func(user string, password string) (interface{}, bool) {
+	return func(user string, password string) (interface{}, bool) {
+		expected, ok := users[user]
+		if !ok {
+			// compare anyway to not reveal which users exist
+			expected = "\x00"
+		}
+
+		if secureCompare(password, expected) && ok {
+			return user, true
+		}
+		return nil, false
+	}
+}
+
+// StaticTokens returns a verifier for AuthConfig.Bearer or AuthConfig.APIKey that looks up tokens in a map of
+// tokens and their principals. Every token is compared in constant time
+func StaticTokens(tokens map[string]interface{}) func(token string) (interface{}, bool) {
+	return func(token string) (interface{}, bool) {
+		var principal interface{}
+		found := false
+
+		for t, p := range tokens {
+			if secureCompare(token, t) {
+				principal, found = p, true
+			}
+		}
+		return principal, found
+	}
+}
+
+// secureCompare compares two strings in constant time without leaking their length
+func secureCompare(a string, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+// WebSocket implements the IWebSocketMiddleware interface
+func (a *Auth) WebSocket() {}
+
+// Call executes the Middleware
+// Note: Do not call this yourself
+func (a *Auth) Call(respw http.ResponseWriter, req *http.Request) bool {
+	var principal interface{}
+	ok := false
+	provided := true
+
+	authorization := req.Header.Get("Authorization")
+	scheme := strings.ToLower(strings.SplitN(authorization, " ", 2)[0])
+
+	switch {
+	case scheme == "basic" && a.config.Basic != nil:
+		if user, password, valid := req.BasicAuth(); valid {
+			principal, ok = a.config.Basic(user, password)
+		}
+	case scheme == "bearer" && a.config.Bearer != nil:
+		if token := strings.TrimSpace(authorization[len("bearer"):]); token != "" {
+			principal, ok = a.config.Bearer(token)
+		}
+	case authorization == "" && a.config.APIKey != nil && req.Header.Get(a.config.APIKeyHeader) != "":
+		principal, ok = a.config.APIKey(req.Header.Get(a.config.APIKeyHeader))
+	default:
+		provided = authorization != ""
+	}
+
+	if ok {
+		context.Set(req, "_Principal", principal, true)
+		return true
+	}
+
+	if !provided && a.config.Optional {
+		return true
+	}
+
+	if provided {
+		Log.Warningd(JLData{"IP": ClientIP(req), "path": req.URL.Path, "scheme": scheme}, "authentication failed")
+	}
+
+	a.challenge(respw, scheme == "bearer")
+	ErrorHandler(http.StatusUnauthorized)(respw, req)
+
+	return false
+}
+
+// challenge adds a WWW-Authenticate header for every configured scheme
+func (a *Auth) challenge(respw http.ResponseWriter, invalidToken bool) {
+	realm := strings.Replace(strings.Replace(a.config.Realm, "\\", "\\\\", -1), "\"", "\\\"", -1)
+
+	if a.config.Basic != nil {
+		respw.Header().Add("WWW-Authenticate", "Basic realm=\""+realm+"\", charset=\"UTF-8\"")
+	}
+
+	if a.config.Bearer != nil {
+		if invalidToken {
+			respw.Header().Add("WWW-Authenticate", "Bearer realm=\""+realm+"\", error=\"invalid_token\"")
+		} else {
+			respw.Header().Add("WWW-Authenticate", "Bearer realm=\""+realm+"\"")
+		}
+	}
+}
+
+// GetPrincipal returns the principal authenticated by the Auth middleware or nil
+func GetPrincipal(req *http.Request) interface{} {
+	if principal, ok := context.GetOk(req, "_Principal"); ok {
+		return principal
+	}
+	return nil
+}
+
+// Principal returns the authenticated principal of the current request or nil
+func (c *Controller) Principal() interface{} {
+	return GetPrincipal(c.Req)
+}
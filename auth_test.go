@@ -0,0 +1,60 @@
+package jantar
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	var principal interface{}
+
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	j := setupServer(false)
+	j.AddMiddleware(NewAuth(&AuthConfig{
+		Realm:  "internal",
+		Basic:  BasicAuthUsers(map[string]string{"admin": "secret"}),
+		Bearer: StaticTokens(map[string]interface{}{"token": "service"}),
+		APIKey: StaticTokens(map[string]interface{}{"key": "client"}),
+	}))
+	j.AddRoute("GET", "/", func(rw http.ResponseWriter, r *http.Request) {
+		principal = GetPrincipal(r)
+	})
+
+	for _, test := range []struct {
+		header    string
+		value     string
+		status    int
+		principal interface{}
+	}{
+		{"Authorization", "Basic YWRtaW46c2VjcmV0", 200, "admin"},
+		{"Authorization", "Basic YWRtaW46d3Jvbmc=", 401, nil},
+		{"Authorization", "Bearer token", 200, "service"},
+		{"Authorization", "Bearer wrong", 401, nil},
+		{"X-API-Key", "key", 200, "client"},
+		{"X-API-Key", "wrong", 401, nil},
+		{"", "", 401, nil},
+	} {
+		principal = nil
+
+		rw, req := testRequest("GET", "/")
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		j.ServeHTTP(rw, req)
+
+		assertEqual(test.status, rw.Code)
+		assertEqual(test.principal, principal)
+
+		if test.status == 401 {
+			challenges := rw.Header()["Www-Authenticate"]
+			if len(challenges) != 2 || challenges[0] != `Basic realm="internal", charset="UTF-8"` {
+				t.Errorf("Expected Basic and Bearer challenges, got %v.", challenges)
+			}
+		}
+	}
+}
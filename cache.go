@@ -0,0 +1,468 @@
+package jantar
+
+import (
+	"bytes"
+	"container/list"
+	"github.com/tsurai/jantar/context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedResponse is a response stored by the Cache middleware
+type CachedResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Created time.Time
+	Expires time.Time
+	// Vary lists the request headers of a response with a Vary header. Such responses are stored under a key
+	// including these headers and an entry without Status refers to them
+	Vary []string
+}
+
+// ICacheStore is an interface that describes a storage for cached responses. Implementations have to be
+// safe for concurrent use
+type ICacheStore interface {
+	// Get returns the response stored for key if it hasn't expired yet
+	Get(key string, now time.Time) (*CachedResponse, bool)
+	// Set stores a response for key
+	Set(key string, response *CachedResponse)
+	// Purge removes all responses whose key starts with prefix and returns their number
+	Purge(prefix string) int
+}
+
+// CacheConfig configures the Cache middleware
+type CacheConfig struct {
+	// TTL applies to all GET and HEAD routes without their own ttl. A zero TTL only caches routes with their own ttl
+	TTL time.Duration
+	// Headers lists request headers that are part of the cache key, e.g. "Accept-Language"
+	Headers []string
+	// SessionCookies lists cookies that identify a user. Requests carrying one of them bypass the cache.
+	// Defaults to AMBER_SESSION
+	SessionCookies []string
+	// MaxEntrySize is the maximal size in bytes of cached bodies. Defaults to 1MB
+	MaxEntrySize int
+	// Store keeps the responses. Defaults to a LRU store holding 1000 responses
+	Store ICacheStore
+}
+
+// Cache is a Middleware that serves successful GET and HEAD responses from a cache. Handlers can control
+// caching with the Cache-Control header: no-store and private responses are not cached, while max-age and
+// s-maxage override the ttl of the route. Responses containing a csrf token or csp nonce and responses setting
+// cookies other than the csrf cookie are never stored as they belong to a single visitor
+type Cache struct {
+	Middleware
+	config *CacheConfig
+}
+
+// cacheWriter passes the response to the client while keeping a copy for the cache
+type cacheWriter struct {
+	http.ResponseWriter
+	status   int
+	header   http.Header
+	buf      bytes.Buffer
+	max      int
+	uncached bool
+}
+
+// NewCache creates a new response caching Middleware. A nil config uses the default settings
+func NewCache(config *CacheConfig) *Cache {
+	if config == nil {
+		config = &CacheConfig{}
+	}
+
+	if config.SessionCookies == nil {
+		config.SessionCookies = []string{"AMBER_SESSION"}
+	}
+
+	if config.MaxEntrySize == 0 {
+		config.MaxEntrySize = 1 << 20
+	}
+
+	if config.Store == nil {
+		config.Store = NewLRUCacheStore(1000)
+	}
+
+	return &Cache{config: config}
+}
+
+// Cache sets the time responses of this route are cached by the Cache middleware. A negative ttl disables
+// caching for this route
+func (r *route) Cache(ttl time.Duration) *route {
+	r.cacheTTL = ttl
+	return r
+}
+
+// Purge removes all cached responses whose key starts with prefix. Keys start with the method and path of the
+// request, e.g. "GET /articles/"
+func (c *Cache) Purge(prefix string) int {
+	n := c.config.Store.Purge(prefix)
+	Log.Debugd(JLData{"prefix": prefix, "entries": n}, "purged cached responses")
+	return n
+}
+
+// Key returns the cache key of a request. It consists of the method, path, sorted query and the configured
+// request headers
+func (c *Cache) Key(req *http.Request) string {
+	key := req.Method + " " + req.URL.Path
+	if query := req.URL.Query(); len(query) > 0 {
+		key += "?" + query.Encode()
+	}
+
+	for _, name := range c.config.Headers {
+		key += "\n" + http.CanonicalHeaderKey(name) + ": " + strings.Join(req.Header[http.CanonicalHeaderKey(name)], ",")
+	}
+
+	return key
+}
+
+// ttl returns the lifetime of responses of a request or 0 if it must not be cached
+func (c *Cache) ttl(req *http.Request) time.Duration {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return 0
+	}
+
+	for _, name := range c.config.SessionCookies {
+		if _, err := req.Cookie(name); err == nil {
+			return 0
+		}
+	}
+
+	if cc := parseCacheControl(req.Header.Get("Cache-Control")); cc.has("no-store") {
+		return 0
+	}
+
+	ttl := c.config.TTL
+	if route, ok := context.Get(req, "_Route").(*route); ok && route != nil && route.cacheTTL != 0 {
+		ttl = route.cacheTTL
+	}
+
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+// Wrap implements the IHandlerMiddleware interface
+// Note: Do not call this yourself
+func (c *Cache) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respw http.ResponseWriter, req *http.Request) {
+		ttl := c.ttl(req)
+		if ttl == 0 {
+			next.ServeHTTP(respw, req)
+			return
+		}
+
+		key := c.Key(req)
+		now := time.Now()
+
+		// no-cache requires revalidation which means running the handler again
+		if !parseCacheControl(req.Header.Get("Cache-Control")).has("no-cache") {
+			if cached, ok := c.lookup(key, req, now); ok {
+				writeCachedResponse(respw, req, cached, now)
+				return
+			}
+		}
+
+		cw := &cacheWriter{ResponseWriter: respw, max: c.config.MaxEntrySize}
+		respw.Header().Set("X-Cache", "MISS")
+		next.ServeHTTP(cw, req)
+
+		if cw.status == 0 {
+			cw.WriteHeader(http.StatusOK)
+		}
+
+		if cw.uncached || cw.status != http.StatusOK || isPersonalized(req) || !storableHeader(req, cw.header) {
+			return
+		}
+
+		cc := parseCacheControl(cw.header.Get("Cache-Control"))
+		if cc.has("no-store") || cc.has("private") || cc.has("no-cache") {
+			return
+		}
+
+		if maxAge, ok := cc.seconds("s-maxage"); ok {
+			ttl = maxAge
+		} else if maxAge, ok := cc.seconds("max-age"); ok {
+			ttl = maxAge
+		}
+
+		vary := varyHeaders(cw.header)
+		if ttl <= 0 || (len(vary) == 1 && vary[0] == "*") {
+			return
+		}
+
+		if len(vary) > 0 {
+			c.config.Store.Set(key, &CachedResponse{Created: now, Expires: now.Add(ttl), Vary: vary})
+			key = varyKey(key, req, vary)
+		}
+
+		c.config.Store.Set(key, &CachedResponse{
+			Status:  cw.status,
+			Header:  cw.header,
+			Body:    cw.buf.Bytes(),
+			Created: now,
+			Expires: now.Add(ttl),
+			Vary:    vary,
+		})
+	})
+}
+
+// lookup returns the cached response of a request. Entries of responses with a Vary header refer to the
+// variant matching the request
+func (c *Cache) lookup(key string, req *http.Request, now time.Time) (*CachedResponse, bool) {
+	cached, ok := c.config.Store.Get(key, now)
+	if ok && cached.Status == 0 {
+		return c.config.Store.Get(varyKey(key, req, cached.Vary), now)
+	}
+	return cached, ok
+}
+
+// isPersonalized checks if a response contains data of a single visitor like the csrf token or the csp nonce
+func isPersonalized(req *http.Request) bool {
+	if _, ok := context.GetOk(req, "_csrfRendered"); ok {
+		return true
+	}
+
+	_, ok := context.GetOk(req, "_CSPNonceUsed")
+	return ok
+}
+
+// storableHeader removes the header of a response that are set for every visitor by the framework. Such
+// header are sent with each response anyway. It returns false if the response sets other cookies
+func storableHeader(req *http.Request, header http.Header) bool {
+	var cookies []string
+	for _, cookie := range header["Set-Cookie"] {
+		if !strings.HasPrefix(cookie, "JANTAR_ID=") {
+			cookies = append(cookies, cookie)
+		}
+	}
+
+	if len(cookies) != 0 {
+		return false
+	}
+	header.Del("Set-Cookie")
+
+	// the policy contains the nonce of the request
+	if _, ok := context.GetOk(req, "_CSPNonce"); ok {
+		header.Del("Content-Security-Policy")
+		header.Del("Content-Security-Policy-Report-Only")
+	}
+
+	return true
+}
+
+// varyHeaders returns the sorted request header names listed in the Vary header of a response
+func varyHeaders(header http.Header) []string {
+	var names []string
+	seen := make(map[string]bool)
+
+	for _, value := range header["Vary"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = http.CanonicalHeaderKey(strings.TrimSpace(name)); name == "*" {
+				return []string{"*"}
+			} else if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func varyKey(key string, req *http.Request, vary []string) string {
+	for _, name := range vary {
+		key += "\nVary " + name + ": " + strings.Join(req.Header[name], ",")
+	}
+	return key
+}
+
+func writeCachedResponse(respw http.ResponseWriter, req *http.Request, cached *CachedResponse, now time.Time) {
+	header := respw.Header()
+	for key, value := range cached.Header {
+		header[key] = value
+	}
+	header.Set("X-Cache", "HIT")
+	header.Set("Age", strconv.Itoa(int(now.Sub(cached.Created)/time.Second)))
+
+	Log.Debugd(JLData{"method": req.Method, "path": req.URL.Path}, "served cached response")
+
+	respw.WriteHeader(cached.Status)
+	if req.Method != "HEAD" {
+		respw.Write(cached.Body)
+	}
+}
+
+func (w *cacheWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.header = w.ResponseWriter.Header().Clone()
+		w.header.Del("X-Cache")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !w.uncached {
+		if w.buf.Len()+len(data) > w.max {
+			w.uncached = true
+			w.buf.Reset()
+		} else {
+			w.buf.Write(data)
+		}
+	}
+
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush sends the data to the client. Streamed responses are not cached
+func (w *cacheWriter) Flush() {
+	w.uncached = true
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// cacheControl holds the directives of a Cache-Control header
+type cacheControl map[string]string
+
+func parseCacheControl(value string) cacheControl {
+	cc := make(cacheControl)
+
+	for _, directive := range strings.Split(value, ",") {
+		directive = strings.TrimSpace(directive)
+		if directive == "" {
+			continue
+		}
+
+		if offset := strings.Index(directive, "="); offset != -1 {
+			cc[strings.ToLower(directive[:offset])] = strings.Trim(directive[offset+1:], "\"")
+		} else {
+			cc[strings.ToLower(directive)] = ""
+		}
+	}
+
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	value, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
+
+// LRUCacheStore is an in-memory ICacheStore that evicts the least recently used response once it is full
+type LRUCacheStore struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type lruEntry struct {
+	key      string
+	response *CachedResponse
+}
+
+// NewLRUCacheStore creates a new LRUCacheStore holding up to capacity responses
+func NewLRUCacheStore(capacity int) *LRUCacheStore {
+	return &LRUCacheStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get implements the ICacheStore interface
+func (s *LRUCacheStore) Get(key string, now time.Time) (*CachedResponse, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*lruEntry)
+	if !now.Before(entry.response.Expires) {
+		s.remove(elem)
+		return nil, false
+	}
+
+	s.order.MoveToFront(elem)
+	return entry.response, true
+}
+
+// Set implements the ICacheStore interface
+func (s *LRUCacheStore) Set(key string, response *CachedResponse) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		elem.Value.(*lruEntry).response = response
+		s.order.MoveToFront(elem)
+		return
+	}
+
+	s.entries[key] = s.order.PushFront(&lruEntry{key: key, response: response})
+
+	for s.capacity > 0 && s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+}
+
+// Purge implements the ICacheStore interface
+func (s *LRUCacheStore) Purge(prefix string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var keys []string
+	for key := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		s.remove(s.entries[key])
+	}
+
+	return len(keys)
+}
+
+// Len returns the number of stored responses
+func (s *LRUCacheStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.order.Len()
+}
+
+func (s *LRUCacheStore) remove(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.entries, elem.Value.(*lruEntry).key)
+}
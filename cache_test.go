@@ -0,0 +1,192 @@
+package jantar
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	calls := 0
+
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	cache := NewCache(&CacheConfig{Headers: []string{"Accept-Language"}})
+
+	j := setupServer(false)
+	j.AddMiddleware(cache)
+	j.AddRoute("GET", "/", func(rw http.ResponseWriter, r *http.Request) {
+		calls++
+		rw.Write([]byte("hello"))
+	}).Cache(time.Minute)
+	j.AddRoute("GET", "/private", func(rw http.ResponseWriter, r *http.Request) {
+		calls++
+		rw.Header().Set("Cache-Control", "private")
+	}).Cache(time.Minute)
+	j.AddRoute("GET", "/uncached", func(rw http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+
+	serve := func(path string, setup func(req *http.Request)) string {
+		rw, req := testRequest("GET", path)
+		if setup != nil {
+			setup(req)
+		}
+		j.ServeHTTP(rw, req)
+		return rw.Header().Get("X-Cache")
+	}
+
+	/* cached responses */
+	assertEqual("MISS", serve("/?b=2&a=1", nil))
+	assertEqual("HIT", serve("/?a=1&b=2", nil))
+	assertEqual(1, calls)
+
+	/* query and selected headers are part of the key */
+	assertEqual("MISS", serve("/", nil))
+	assertEqual("MISS", serve("/", func(req *http.Request) { req.Header.Set("Accept-Language", "de") }))
+	assertEqual(3, calls)
+
+	/* session cookies and no-cache bypass the cache */
+	assertEqual("", serve("/", func(req *http.Request) { req.AddCookie(&http.Cookie{Name: "AMBER_SESSION", Value: "x"}) }))
+	assertEqual("MISS", serve("/", func(req *http.Request) { req.Header.Set("Cache-Control", "no-cache") }))
+	assertEqual(5, calls)
+
+	/* handlers can opt out and routes without ttl are not cached */
+	serve("/private", nil)
+	serve("/private", nil)
+	serve("/uncached", nil)
+	serve("/uncached", nil)
+	assertEqual(9, calls)
+
+	/* purge by prefix */
+	assertEqual(3, cache.Purge("GET /"))
+	assertEqual("MISS", serve("/", nil))
+
+	/* responses are cached per value of the request headers listed in Vary */
+	j.AddRoute("GET", "/vary", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Vary", "Accept-Encoding")
+		rw.Write([]byte("encoding " + r.Header.Get("Accept-Encoding")))
+	}).Cache(time.Minute)
+
+	gzip := func(req *http.Request) { req.Header.Set("Accept-Encoding", "gzip") }
+	assertEqual("MISS", serve("/vary", gzip))
+	assertEqual("MISS", serve("/vary", nil))
+	assertEqual("HIT", serve("/vary", gzip))
+
+	rw, req := testRequest("GET", "/vary")
+	j.ServeHTTP(rw, req)
+	assertEqual("HIT", rw.Header().Get("X-Cache"))
+	assertEqual("encoding ", rw.Body.String())
+}
+
+func TestCacheCSRF(t *testing.T) {
+	tokenRegexp := regexp.MustCompile(`name="csrf-token" content="([0-9a-f]+)"`)
+
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	j := setupServer(true)
+	j.AddMiddleware(NewCache(nil))
+	setupTemplate(j, "index.html", "<html><head></head><body></body></html>")
+	j.AddRoute("GET", "/", func(rw http.ResponseWriter, r *http.Request) {
+		j.tm.RenderTemplate(rw, r, "index.html", nil)
+	}).Cache(time.Minute)
+
+	/* pages with the token of a visitor are never served to other visitors */
+	for _, id := range []string{strings.Repeat("a", 64), strings.Repeat("b", 64)} {
+		rw, req := testRequest("GET", "/")
+		req.AddCookie(&http.Cookie{Name: "JANTAR_ID", Value: id})
+		j.ServeHTTP(rw, req)
+
+		assertEqual("MISS", rw.Header().Get("X-Cache"))
+		if match := tokenRegexp.FindStringSubmatch(rw.Body.String()); match == nil || !verifyToken(match[1], id) {
+			t.Errorf("Expected a token for %v, got %v.", id, rw.Body.String())
+		}
+	}
+
+	/* neither are the pages of new visitors */
+	for i := 0; i < 2; i++ {
+		rw, req := testRequest("GET", "/")
+		j.ServeHTTP(rw, req)
+		assertEqual("MISS", rw.Header().Get("X-Cache"))
+	}
+
+	/* pages without token are shared, but the csrf cookie of a new visitor is not */
+	j.AddRoute("GET", "/plain", helloHandler).Cache(time.Minute)
+
+	rw, req := testRequest("GET", "/plain")
+	j.ServeHTTP(rw, req)
+	assertEqual("MISS", rw.Header().Get("X-Cache"))
+	first := rw.Header().Get("Set-Cookie")
+
+	rw, req = testRequest("GET", "/plain")
+	req.AddCookie(&http.Cookie{Name: "JANTAR_ID", Value: strings.Repeat("a", 64)})
+	j.ServeHTTP(rw, req)
+	assertEqual("HIT", rw.Header().Get("X-Cache"))
+	assertEqual("", rw.Header().Get("Set-Cookie"))
+	assertEqual("hello", rw.Body.String())
+
+	rw, req = testRequest("GET", "/plain")
+	j.ServeHTTP(rw, req)
+	assertEqual("HIT", rw.Header().Get("X-Cache"))
+	if cookie := rw.Header().Get("Set-Cookie"); cookie == "" || cookie == first {
+		t.Errorf("Expected a new csrf cookie, got %v.", cookie)
+	}
+
+	/* the nonce only prevents caching if it has been used */
+	security := &SecurityHeaders{ContentSecurityPolicy: "default-src 'self'", CSPNonce: true}
+	j.AddRoute("GET", "/unused", helloHandler).Cache(time.Minute).SecurityHeaders(security)
+	j.AddRoute("GET", "/used", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(CSPNonce(r)))
+	}).Cache(time.Minute).SecurityHeaders(security)
+
+	var policies []string
+	for _, expected := range []string{"MISS", "HIT"} {
+		rw, req = testRequest("GET", "/unused")
+		j.ServeHTTP(rw, req)
+		assertEqual(expected, rw.Header().Get("X-Cache"))
+		policies = append(policies, rw.Header().Get("Content-Security-Policy"))
+
+		rw, req = testRequest("GET", "/used")
+		j.ServeHTTP(rw, req)
+		assertEqual("MISS", rw.Header().Get("X-Cache"))
+	}
+
+	if policies[0] == policies[1] {
+		t.Errorf("Expected a new nonce for every response, got %v.", policies)
+	}
+}
+
+func TestLRUCacheStore(t *testing.T) {
+	now := time.Now()
+	store := NewLRUCacheStore(2)
+
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	store.Set("a", &CachedResponse{Expires: now.Add(time.Minute)})
+	store.Set("b", &CachedResponse{Expires: now.Add(time.Minute)})
+	store.Get("a", now)
+	store.Set("c", &CachedResponse{Expires: now.Add(time.Minute)})
+
+	_, ok := store.Get("b", now)
+	assertEqual(false, ok)
+	_, ok = store.Get("a", now)
+	assertEqual(true, ok)
+
+	_, ok = store.Get("c", now.Add(time.Hour))
+	assertEqual(false, ok)
+	assertEqual(1, store.Len())
+}
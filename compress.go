@@ -0,0 +1,260 @@
+package jantar
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"github.com/tsurai/jantar/context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CompressConfig configures the Compression middleware
+type CompressConfig struct {
+	// Level is the compression level used for gzip and deflate. Defaults to gzip.DefaultCompression
+	Level int
+	// MinSize is the minimal body size in bytes worth compressing. Defaults to 1024
+	MinSize int
+	// ExcludedTypes is a list of content type prefixes that are already compressed
+	ExcludedTypes []string
+	// ExcludeCSRF disables compression for responses that render the csrf token. Rendered tokens are masked
+	// for every response to protect against BREACH, so this is only needed for additional secrets in the page
+	ExcludeCSRF bool
+}
+
+// Compression is a Middleware that compresses responses with gzip or deflate depending on Accept-Encoding
+type Compression struct {
+	Middleware
+	config *CompressConfig
+	gzip   sync.Pool
+	flate  sync.Pool
+}
+
+var defaultExcludedTypes = []string{
+	"image/", "video/", "audio/", "font/woff", "application/zip", "application/gzip", "application/x-gzip",
+	"application/x-bzip2", "application/x-7z-compressed", "application/x-rar-compressed", "application/octet-stream",
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	c        *Compression
+	req      *http.Request
+	encoding string
+	status   int
+	buf      []byte
+	writer   io.WriteCloser
+	decided  bool
+}
+
+// NewCompression creates a new compression Middleware. A nil config uses the default settings
+func NewCompression(config *CompressConfig) *Compression {
+	if config == nil {
+		config = &CompressConfig{}
+	}
+
+	if config.Level == 0 {
+		config.Level = gzip.DefaultCompression
+	}
+
+	if config.MinSize == 0 {
+		config.MinSize = 1024
+	}
+
+	if config.ExcludedTypes == nil {
+		config.ExcludedTypes = defaultExcludedTypes
+	}
+
+	c := &Compression{config: config}
+	c.gzip.New = func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, config.Level)
+		return w
+	}
+	c.flate.New = func() interface{} {
+		w, _ := flate.NewWriter(nil, config.Level)
+		return w
+	}
+
+	return c
+}
+
+// Wrap implements the IHandlerMiddleware interface
+// Note: Do not call this yourself
+func (c *Compression) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respw http.ResponseWriter, req *http.Request) {
+		encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"))
+		if encoding == "" || req.Method == "HEAD" {
+			next.ServeHTTP(respw, req)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: respw, c: c, req: req, encoding: encoding}
+		defer cw.close()
+
+		next.ServeHTTP(cw, req)
+	})
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header. Returns an empty string if
+// neither is acceptable
+func negotiateEncoding(header string) string {
+	best := ""
+	bestQ := 0.0
+
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, _ = strconv.ParseFloat(param[2:], 64)
+			}
+		}
+
+		if coding == "*" {
+			coding = "gzip"
+		}
+
+		// prefer gzip over deflate if both have the same quality
+		if (coding == "gzip" || coding == "deflate") && q > 0 && (q > bestQ || (q == bestQ && coding == "gzip")) {
+			best = coding
+			bestQ = q
+		}
+	}
+
+	return best
+}
+
+func (c *Compression) isExcluded(contentType string) bool {
+	for _, excluded := range c.config.ExcludedTypes {
+		if strings.HasPrefix(contentType, excluded) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) < w.c.config.MinSize {
+			return len(data), nil
+		}
+
+		w.decide(true)
+		if err := w.writeBuffer(); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+
+	if w.writer != nil {
+		return w.writer.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush sends all buffered data to the client. Streaming responses are compressed regardless of their size
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(true)
+		w.writeBuffer()
+	}
+
+	if f, ok := w.writer.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// decide determines whether the response is compressed and writes the header
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(w.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	eligible := w.status >= 200 && w.status != http.StatusNoContent && w.status != http.StatusNotModified &&
+		header.Get("Content-Encoding") == "" && !w.c.isExcluded(header.Get("Content-Type"))
+
+	if eligible && w.c.config.ExcludeCSRF {
+		if _, ok := context.GetOk(w.req, "_csrfRendered"); ok {
+			eligible = false
+		}
+	}
+
+	if eligible {
+		header.Add("Vary", "Accept-Encoding")
+	}
+
+	if eligible && compress {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+
+		if w.encoding == "gzip" {
+			gz := w.c.gzip.Get().(*gzip.Writer)
+			gz.Reset(w.ResponseWriter)
+			w.writer = gz
+		} else {
+			fl := w.c.flate.Get().(*flate.Writer)
+			fl.Reset(w.ResponseWriter)
+			w.writer = fl
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *compressWriter) writeBuffer() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	buf := w.buf
+	w.buf = nil
+
+	var err error
+	if w.writer != nil {
+		_, err = w.writer.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close writes small uncompressed bodies and finishes the compressed stream
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+		w.writeBuffer()
+	}
+
+	switch writer := w.writer.(type) {
+	case *gzip.Writer:
+		writer.Close()
+		w.c.gzip.Put(writer)
+	case *flate.Writer:
+		writer.Close()
+		w.c.flate.Put(writer)
+	}
+}
@@ -0,0 +1,52 @@
+package jantar
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	body := strings.Repeat("jantar ", 500)
+
+	j := setupServer(false)
+	j.AddMiddleware(NewCompression(nil))
+	j.AddRoute("GET", "/large", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(body))
+	})
+	j.AddRoute("GET", "/small", helloHandler)
+	j.AddRoute("GET", "/image", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "image/png")
+		rw.Write([]byte(body))
+	})
+
+	/* large bodies are compressed */
+	rw, req := testRequest("GET", "/large")
+	req.Header.Set("Accept-Encoding", "deflate;q=0.5, gzip")
+	j.ServeHTTP(rw, req)
+
+	if rw.Header().Get("Content-Encoding") != "gzip" || rw.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Expected gzip encoded response, got header %v.", rw.Header())
+	}
+
+	gz, err := gzip.NewReader(rw.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(gz); string(data) != body {
+		t.Errorf("Expected decompressed body to match.")
+	}
+
+	/* small bodies, excluded types and clients without support are not compressed */
+	for path, encoding := range map[string]string{"/small": "gzip", "/image": "gzip", "/large": "br, gzip;q=0"} {
+		rw, req = testRequest("GET", path)
+		req.Header.Set("Accept-Encoding", encoding)
+		j.ServeHTTP(rw, req)
+
+		if rw.Header().Get("Content-Encoding") != "" {
+			t.Errorf("Expected %s with Accept-Encoding '%s' to be uncompressed.", path, encoding)
+		}
+	}
+}
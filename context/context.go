@@ -4,7 +4,9 @@
 package context
 
 import (
+	stdcontext "context"
 	"net/http"
+	"sync"
 )
 
 type data struct {
@@ -12,11 +14,36 @@ type data struct {
 	readOnly bool
 }
 
+type originKey struct{}
+
+type origin struct {
+	req *http.Request
+}
+
 var (
+	mutex       sync.RWMutex
 	globalData  = make(map[interface{}]data)
 	requestData = make(map[*http.Request]map[interface{}]data)
 )
 
+// Bind returns a shallow copy of req. Requests derived from the copy with WithContext share its data, so
+// middleware can replace the request without losing the per-request data
+func Bind(req *http.Request) *http.Request {
+	o := &origin{}
+	o.req = req.WithContext(stdcontext.WithValue(req.Context(), originKey{}, o))
+	return o.req
+}
+
+// bound returns the request the data of req is stored for
+func bound(req *http.Request) *http.Request {
+	if req != nil {
+		if o, ok := req.Context().Value(originKey{}).(*origin); ok {
+			return o.req
+		}
+	}
+	return req
+}
+
 func UrlParam(req *http.Request) map[string]string {
 	if p, ok := GetOk(req, "_UrlParam"); ok {
 		return p.(map[string]string)
@@ -31,6 +58,9 @@ func RenderArgs(req *http.Request) map[string]interface{} {
 
 // SetGlobal saves a value with given key in the global context
 func SetGlobal(key, value interface{}, readOnly bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
 	if gd, ok := globalData[key]; !ok || !gd.readOnly {
 		globalData[key] = data{value, readOnly}
 	}
@@ -38,17 +68,28 @@ func SetGlobal(key, value interface{}, readOnly bool) {
 
 // GetGlobal searches for a value with given key in the global context and returns it
 func GetGlobal(key interface{}) interface{} {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
 	return globalData[key].value
 }
 
 // GetGlobalOk does the same as GetGlobal but returns an additional boolean indicating if a value with the given key was found
 func GetGlobalOk(key interface{}) (interface{}, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
 	gd, ok := globalData[key]
 	return gd.value, ok
 }
 
 // Set saves the a value with given key for a specific http.Request
 func Set(req *http.Request, key, value interface{}, readOnly bool) {
+	req = bound(req)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
 	rd, ok := requestData[req]
 	if !ok && rd == nil {
 		requestData[req] = make(map[interface{}]data)
@@ -61,6 +102,11 @@ func Set(req *http.Request, key, value interface{}, readOnly bool) {
 
 // Get returns a value with given name and request
 func Get(req *http.Request, key interface{}) interface{} {
+	req = bound(req)
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
 	if requestData[req] != nil {
 		return requestData[req][key].value
 	}
@@ -69,6 +115,11 @@ func Get(req *http.Request, key interface{}) interface{} {
 
 // GetOk does the same as Get but returns an additional boolean indicating if a value with the given key and request was found
 func GetOk(req *http.Request, key interface{}) (interface{}, bool) {
+	req = bound(req)
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+
 	if requestData[req] == nil {
 		return nil, false
 	}
@@ -79,5 +130,8 @@ func GetOk(req *http.Request, key interface{}) (interface{}, bool) {
 
 // ClearData deletes all data belonging to a given request
 func ClearData(req *http.Request) {
-	delete(requestData, req)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	delete(requestData, bound(req))
 }
@@ -22,7 +22,12 @@ type Controller struct {
 }
 
 func newController(t reflect.Type, respw http.ResponseWriter, req *http.Request, name string, action string) IController {
-	c := reflect.New(t).Interface().(IController)
+	v := reflect.New(t)
+	if services, ok := GetModule(moduleServices).(*services); ok {
+		services.inject(t, v.Elem())
+	}
+
+	c := v.Interface().(IController)
 	c.setInternal(respw, req, name, action)
 
 	return c
@@ -49,13 +54,13 @@ func (c *Controller) UrlParam() map[string]string {
 	return context.Get(c.Req, "_UrlParam").(map[string]string)
 }
 
-// Redirect redirects the current request to a given named route using args to complete url variables
+// Redirect redirects the current request to a given named route using args to complete url variables.
+// Unknown route names result in a 500 internal server error
 func (c *Controller) Redirect(to string, args ...interface{}) {
-	router := GetModule(ModuleRouter).(*router)
-
-	url := router.getReverseURL(to, args)
-	c.Respw.Header().Set("Location", url)
-	c.Respw.WriteHeader(302)
+	if err := c.RedirectTo(to, args...); err != nil {
+		Log.Warningd(JLData{"name": to}, err.Error())
+		http.Error(c.Respw, "500 internal server error", 500)
+	}
 }
 
 // Render gets the template for the calling action and renders it
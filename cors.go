@@ -0,0 +1,185 @@
+package jantar
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig configures the CORS middleware
+type CORSConfig struct {
+	// AllowedOrigins is a list of origins like "https://example.com". An origin may contain a single wildcard
+	// like "https://*.example.com" and "*" allows every origin
+	AllowedOrigins []string
+	// AllowOriginFunc is called for origins not matching AllowedOrigins
+	AllowOriginFunc func(origin string, req *http.Request) bool
+	// AllowedMethods defaults to GET, HEAD, POST, PUT and DELETE
+	AllowedMethods []string
+	// AllowedHeaders defaults to Content-Type, X-Requested-With and the csrf header
+	AllowedHeaders []string
+	// ExposedHeaders lists response headers scripts are allowed to read
+	ExposedHeaders []string
+	// AllowCredentials allows cookies to be sent with cross-origin requests. It is ignored for the "*" origin.
+	// Requests with credentials still have to carry the csrf token as header or form value
+	AllowCredentials bool
+	// MaxAge is the number of seconds a preflight may be cached. Zero omits the header
+	MaxAge int
+}
+
+// CORS is a Middleware that handles cross-origin resource sharing. Preflight requests are answered directly
+// without reaching a route handler
+type CORS struct {
+	Middleware
+	config *CORSConfig
+}
+
+// NewCORS creates a new CORS Middleware. A nil config allows no origin
+func NewCORS(config *CORSConfig) *CORS {
+	if config == nil {
+		config = &CORSConfig{}
+	}
+
+	if config.AllowedMethods == nil {
+		config.AllowedMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE"}
+	}
+
+	if config.AllowedHeaders == nil {
+		config.AllowedHeaders = []string{"Content-Type", "X-Requested-With", CSRFHeader}
+	}
+
+	if config.AllowCredentials && config.allowsAny() {
+		Log.Warning("cors credentials are not supported for the \"*\" origin")
+	}
+
+	return &CORS{config: config}
+}
+
+// Call executes the Middleware
+// Note: Do not call this yourself
+func (c *CORS) Call(respw http.ResponseWriter, req *http.Request) bool {
+	header := respw.Header()
+	header.Add("Vary", "Origin")
+
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	preflight := req.Method == "OPTIONS" && req.Header.Get("Access-Control-Request-Method") != ""
+	if preflight {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+	}
+
+	if !c.isAllowedOrigin(origin, req) {
+		if preflight {
+			Log.Warningd(JLData{"origin": origin, "path": req.URL.Path}, "rejected cors preflight")
+			ErrorHandler(http.StatusForbidden)(respw, req)
+			return false
+		}
+		return true
+	}
+
+	if c.config.allowsAny() && !c.config.AllowCredentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if c.config.AllowCredentials && !c.config.allowsAny() {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		if len(c.config.ExposedHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(c.config.ExposedHeaders, ", "))
+		}
+		return true
+	}
+
+	return c.preflight(respw, req)
+}
+
+// preflight answers a preflight request. It always stops the request from reaching a route handler
+func (c *CORS) preflight(respw http.ResponseWriter, req *http.Request) bool {
+	header := respw.Header()
+	method := strings.ToUpper(req.Header.Get("Access-Control-Request-Method"))
+
+	if !containsFold(c.config.AllowedMethods, method) {
+		Log.Warningd(JLData{"method": method, "path": req.URL.Path}, "rejected cors preflight: method not allowed")
+		ErrorHandler(http.StatusForbidden)(respw, req)
+		return false
+	}
+
+	var headers []string
+	for _, h := range strings.Split(req.Header.Get("Access-Control-Request-Headers"), ",") {
+		if h = strings.TrimSpace(h); h == "" {
+			continue
+		}
+
+		if !containsFold(c.config.AllowedHeaders, h) {
+			Log.Warningd(JLData{"header": h, "path": req.URL.Path}, "rejected cors preflight: header not allowed")
+			ErrorHandler(http.StatusForbidden)(respw, req)
+			return false
+		}
+		headers = append(headers, h)
+	}
+
+	// preflights for unknown routes are answered like any other request to them
+	router := GetModule(ModuleRouter).(*router)
+	if leaf, _ := router.findPathLeaf(method, req.URL.Path); leaf == nil || leaf.route == nil {
+		ErrorHandler(http.StatusNotFound)(respw, req)
+		return false
+	}
+
+	header.Set("Access-Control-Allow-Methods", strings.Join(c.config.AllowedMethods, ", "))
+	if len(headers) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+
+	if c.config.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(c.config.MaxAge))
+	}
+
+	respw.WriteHeader(http.StatusNoContent)
+	return false
+}
+
+func (c *CORS) isAllowedOrigin(origin string, req *http.Request) bool {
+	for _, allowed := range c.config.AllowedOrigins {
+		if matchOrigin(strings.ToLower(strings.TrimSuffix(allowed, "/")), strings.ToLower(origin)) {
+			return true
+		}
+	}
+
+	return c.config.AllowOriginFunc != nil && c.config.AllowOriginFunc(origin, req)
+}
+
+func (config *CORSConfig) allowsAny() bool {
+	for _, allowed := range config.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin matches an origin against a pattern with at most one wildcard
+func matchOrigin(pattern string, origin string) bool {
+	offset := strings.Index(pattern, "*")
+	if offset == -1 {
+		return pattern == origin
+	}
+
+	prefix, suffix := pattern[:offset], pattern[offset+1:]
+	return len(origin) >= len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
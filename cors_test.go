@@ -0,0 +1,75 @@
+package jantar
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	j := setupServer(true)
+	j.AddMiddleware(NewCORS(&CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	}))
+	j.AddRoute("POST", "/api", helloHandler)
+
+	/* preflights are answered before csrf and route handler */
+	rw, req := testRequest("OPTIONS", "/api")
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "x-csrf-token")
+	j.ServeHTTP(rw, req)
+
+	assertEqual(http.StatusNoContent, rw.Code)
+	assertEqual("https://app.example.com", rw.Header().Get("Access-Control-Allow-Origin"))
+	assertEqual("true", rw.Header().Get("Access-Control-Allow-Credentials"))
+	assertEqual("x-csrf-token", rw.Header().Get("Access-Control-Allow-Headers"))
+	assertEqual("600", rw.Header().Get("Access-Control-Max-Age"))
+	assertEqual("Origin", rw.Header().Get("Vary"))
+
+	/* unknown origins, methods and headers are rejected */
+	for origin, method := range map[string]string{"https://evil.com": "POST", "https://a.example.org": "PATCH"} {
+		rw, req = testRequest("OPTIONS", "/api")
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		j.ServeHTTP(rw, req)
+
+		assertEqual(http.StatusForbidden, rw.Code)
+		assertEqual("", rw.Header().Get("Access-Control-Allow-Methods"))
+	}
+
+	/* preflights for unknown routes */
+	rw, req = testRequest("OPTIONS", "/missing")
+	req.Header.Set("Origin", "https://a.example.org")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	j.ServeHTTP(rw, req)
+	assertEqual(http.StatusNotFound, rw.Code)
+
+	/* actual requests still need the csrf token */
+	rw, req = testRequest("POST", "/api")
+	req.Header.Set("Origin", "https://a.example.org")
+	j.ServeHTTP(rw, req)
+
+	assertEqual(http.StatusBadRequest, rw.Code)
+}
+
+func TestMatchOrigin(t *testing.T) {
+	for pattern, origins := range map[string]map[string]bool{
+		"https://example.com":   {"https://example.com": true, "http://example.com": false, "https://example.com.evil": false},
+		"https://*.example.com": {"https://a.example.com": true, "https://a.b.example.com": true, "https://example.com": false, "https://evilexample.com": false},
+		"*":                     {"https://example.com": true, "null": true},
+	} {
+		for origin, expected := range origins {
+			if got := matchOrigin(pattern, origin); got != expected {
+				t.Errorf("Expected %s to match %s: %v, got %v.", origin, pattern, expected, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package jantar
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CSPReportConfig enables the endpoint collecting Content-Security-Policy violation reports. Add
+// "report-uri /csp-report" to the policy to make browsers send their reports
+type CSPReportConfig struct {
+	// Path of the endpoint. Defaults to "/csp-report"
+	Path string
+	// MaxSize is the maximal size in bytes of a request. Defaults to 64KB
+	MaxSize int64
+	// DedupWindow is the time identical reports are ignored after they have been logged. Defaults to 1 minute
+	DedupWindow time.Duration
+	// Handler is called for every report that is not a duplicate, e.g. to persist or forward it
+	Handler func(req *http.Request, report *CSPReport)
+}
+
+// CSPReport is a normalized violation report sent either as application/csp-report or by the Reporting API
+type CSPReport struct {
+	DocumentURI        string
+	Referrer           string
+	BlockedURI         string
+	ViolatedDirective  string
+	EffectiveDirective string
+	OriginalPolicy     string
+	Disposition        string
+	SourceFile         string
+	Sample             string
+	LineNumber         int
+	ColumnNumber       int
+	StatusCode         int
+	UserAgent          string
+}
+
+// cspReportCollector receives, validates and deduplicates violation reports
+type cspReportCollector struct {
+	mutex  sync.Mutex
+	config *CSPReportConfig
+	seen   map[string]time.Time
+}
+
+// legacyCSPReport is the body of an application/csp-report request
+type legacyCSPReport struct {
+	Report *struct {
+		DocumentURI        string `json:"document-uri"`
+		Referrer           string `json:"referrer"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		OriginalPolicy     string `json:"original-policy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"source-file"`
+		Sample             string `json:"script-sample"`
+		LineNumber         int    `json:"line-number"`
+		ColumnNumber       int    `json:"column-number"`
+		StatusCode         int    `json:"status-code"`
+	} `json:"csp-report"`
+}
+
+// reportingAPIReport is a single report of an application/reports+json request
+type reportingAPIReport struct {
+	Type      string `json:"type"`
+	UserAgent string `json:"user_agent"`
+	Body      *struct {
+		DocumentURL        string `json:"documentURL"`
+		Referrer           string `json:"referrer"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		OriginalPolicy     string `json:"originalPolicy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"sourceFile"`
+		Sample             string `json:"sample"`
+		LineNumber         int    `json:"lineNumber"`
+		ColumnNumber       int    `json:"columnNumber"`
+		StatusCode         int    `json:"statusCode"`
+	} `json:"body"`
+}
+
+func newCSPReportCollector(config *CSPReportConfig) *cspReportCollector {
+	if config.Path == "" {
+		config.Path = "/csp-report"
+	}
+
+	if config.MaxSize == 0 {
+		config.MaxSize = 64 << 10
+	}
+
+	if config.DedupWindow == 0 {
+		config.DedupWindow = time.Minute
+	}
+
+	return &cspReportCollector{config: config, seen: make(map[string]time.Time)}
+}
+
+// ServeHTTP accepts violation reports and answers with 204 no content
+func (c *cspReportCollector) ServeHTTP(respw http.ResponseWriter, req *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != "application/csp-report" && mediaType != "application/reports+json" && mediaType != "application/json" {
+		ErrorHandler(http.StatusUnsupportedMediaType)(respw, req)
+		return
+	}
+
+	data, err := ioutil.ReadAll(req.Body)
+	if err == ErrBodyTooLarge {
+		ErrorHandler(http.StatusRequestEntityTooLarge)(respw, req)
+		return
+	} else if err != nil {
+		ErrorHandler(http.StatusBadRequest)(respw, req)
+		return
+	}
+
+	reports, err := parseCSPReports(data)
+	if err != nil {
+		requestLogger(req).Debugd(JLData{"IP": ClientIP(req), "error": err}, "invalid csp report")
+		ErrorHandler(http.StatusBadRequest)(respw, req)
+		return
+	}
+
+	for _, report := range reports {
+		if report.UserAgent == "" {
+			report.UserAgent = req.UserAgent()
+		}
+
+		if !c.isDuplicate(report) {
+			c.log(req, report)
+			if c.config.Handler != nil {
+				c.config.Handler(req, report)
+			}
+		}
+	}
+
+	respw.WriteHeader(http.StatusNoContent)
+}
+
+// parseCSPReports reads both report formats. Reports of other types and reports without document or
+// directive are skipped
+func parseCSPReports(data []byte) ([]*CSPReport, error) {
+	var reports []*CSPReport
+
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		var list []reportingAPIReport
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+
+		for _, r := range list {
+			if r.Type != "csp-violation" || r.Body == nil {
+				continue
+			}
+
+			reports = append(reports, &CSPReport{
+				DocumentURI:        r.Body.DocumentURL,
+				Referrer:           r.Body.Referrer,
+				BlockedURI:         r.Body.BlockedURL,
+				ViolatedDirective:  r.Body.EffectiveDirective,
+				EffectiveDirective: r.Body.EffectiveDirective,
+				OriginalPolicy:     r.Body.OriginalPolicy,
+				Disposition:        r.Body.Disposition,
+				SourceFile:         r.Body.SourceFile,
+				Sample:             r.Body.Sample,
+				LineNumber:         r.Body.LineNumber,
+				ColumnNumber:       r.Body.ColumnNumber,
+				StatusCode:         r.Body.StatusCode,
+				UserAgent:          r.UserAgent,
+			})
+		}
+	} else {
+		var legacy legacyCSPReport
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return nil, err
+		}
+
+		if r := legacy.Report; r != nil {
+			reports = append(reports, &CSPReport{
+				DocumentURI:        r.DocumentURI,
+				Referrer:           r.Referrer,
+				BlockedURI:         r.BlockedURI,
+				ViolatedDirective:  r.ViolatedDirective,
+				EffectiveDirective: r.EffectiveDirective,
+				OriginalPolicy:     r.OriginalPolicy,
+				Disposition:        r.Disposition,
+				SourceFile:         r.SourceFile,
+				Sample:             r.Sample,
+				LineNumber:         r.LineNumber,
+				ColumnNumber:       r.ColumnNumber,
+				StatusCode:         r.StatusCode,
+			})
+		}
+	}
+
+	var valid []*CSPReport
+	for _, report := range reports {
+		if report.EffectiveDirective == "" {
+			report.EffectiveDirective = report.ViolatedDirective
+		}
+
+		if report.DocumentURI != "" && report.EffectiveDirective != "" {
+			valid = append(valid, report)
+		}
+	}
+
+	return valid, nil
+}
+
+// isDuplicate checks if an identical report has been seen within the dedup window
+func (c *cspReportCollector) isDuplicate(report *CSPReport) bool {
+	key := strings.Join([]string{report.DocumentURI, report.EffectiveDirective, report.BlockedURI, report.SourceFile,
+		report.Disposition}, "\n")
+	now := time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if seen, ok := c.seen[key]; ok && now.Sub(seen) < c.config.DedupWindow {
+		return true
+	}
+
+	// forget expired reports before the map grows too large
+	if len(c.seen) >= 10000 {
+		for k, seen := range c.seen {
+			if now.Sub(seen) >= c.config.DedupWindow {
+				delete(c.seen, k)
+			}
+		}
+	}
+
+	if len(c.seen) < 10000 {
+		c.seen[key] = now
+	}
+	return false
+}
+
+func (c *cspReportCollector) log(req *http.Request, report *CSPReport) {
+	requestLogger(req).Warningd(JLData{
+		"IP":          ClientIP(req),
+		"document":    report.DocumentURI,
+		"directive":   report.EffectiveDirective,
+		"blocked":     report.BlockedURI,
+		"source":      report.SourceFile,
+		"line":        report.LineNumber,
+		"column":      report.ColumnNumber,
+		"disposition": report.Disposition,
+		"sample":      report.Sample,
+		"userAgent":   report.UserAgent,
+	}, "csp violation")
+}
@@ -0,0 +1,57 @@
+package jantar
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCSPReport(t *testing.T) {
+	var reports []*CSPReport
+
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	// the csrf middleware stays enabled as browsers send reports without token
+	j := New(&Config{CSPReport: &CSPReportConfig{
+		MaxSize: 1024,
+		Handler: func(req *http.Request, report *CSPReport) { reports = append(reports, report) },
+	}})
+	Log.SetMinLevel(LogLevelPanic)
+
+	post := func(contentType string, body string) int {
+		rw := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/csp-report", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		j.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	legacy := `{"csp-report": {"document-uri": "https://example.com/", "violated-directive": "script-src 'self'",
+		"blocked-uri": "https://evil.com/x.js", "line-number": 3}}`
+	reporting := `[{"type": "csp-violation", "user_agent": "test", "body": {"documentURL": "https://example.com/a",
+		"effectiveDirective": "style-src", "blockedURL": "inline"}}, {"type": "deprecation", "body": {}}]`
+
+	/* both formats are accepted and duplicates are dropped */
+	assertEqual(http.StatusNoContent, post("application/csp-report", legacy))
+	assertEqual(http.StatusNoContent, post("application/csp-report", legacy))
+	assertEqual(http.StatusNoContent, post("application/reports+json", reporting))
+	assertEqual(2, len(reports))
+
+	if len(reports) == 2 {
+		assertEqual("script-src 'self'", reports[0].EffectiveDirective)
+		assertEqual(3, reports[0].LineNumber)
+		assertEqual("style-src", reports[1].EffectiveDirective)
+		assertEqual("test", reports[1].UserAgent)
+	}
+
+	/* invalid requests */
+	assertEqual(http.StatusUnsupportedMediaType, post("text/plain", legacy))
+	assertEqual(http.StatusBadRequest, post("application/csp-report", "{"))
+	assertEqual(http.StatusRequestEntityTooLarge, post("application/csp-report", legacy+strings.Repeat(" ", 1024)))
+	assertEqual(2, len(reports))
+}
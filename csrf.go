@@ -2,6 +2,7 @@ package jantar
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
 	"github.com/tsurai/jantar/context"
 	"html/template"
@@ -11,9 +12,20 @@ import (
 
 // TODO: accept custom handler
 
+// CSRFHeader is the request header that can carry the csrf token instead of the "_csrf-token" form value
+const CSRFHeader = "X-CSRF-Token"
+
+// CSRFConfig can be given to Jantar to configure the protection against cross-site request forgery
+type CSRFConfig struct {
+	// TrustedOrigins is a list of origins like "https://example.com" that are allowed to open
+	// WebSocket connections in addition to the server's own origin
+	TrustedOrigins []string
+}
+
 // csrf is a Middleware that protects against cross-side request forgery
 type csrf struct {
 	Middleware
+	config *CSRFConfig
 }
 
 // Initialize prepares csrf for usage
@@ -41,8 +53,9 @@ func (c *csrf) Cleanup() {
 func (c *csrf) Call(respw http.ResponseWriter, req *http.Request) bool {
 	var cookieToken string
 
+	// the cookie holds the hex encoded token that has been generated for a new visitor
 	if cookie, err := req.Cookie("JANTAR_ID"); err == nil {
-		cookieToken = hex.EncodeToString([]byte(cookie.Value))
+		cookieToken = cookie.Value
 	} else {
 		cookieTokenBuffer := make([]byte, 32)
 		if n, err := rand.Read(cookieTokenBuffer); n != 32 || err != nil {
@@ -55,19 +68,78 @@ func (c *csrf) Call(respw http.ResponseWriter, req *http.Request) bool {
 
 	context.Set(req, "_csrf", cookieToken, true)
 
-	// check for safe methods
-	if req.Method == "GET" || req.Method == "HEAD" {
+	if !requiresToken(req) {
 		return true
 	}
 
-	if req.PostFormValue("_csrf-token") == cookieToken {
+	// scripts e.g. of single page applications can send the token as header instead of a form value
+	submitted := req.Header.Get(CSRFHeader)
+	if submitted == "" {
+		submitted = req.PostFormValue("_csrf-token")
+	}
+
+	if verifyToken(submitted, cookieToken) {
 		return true
 	}
 
 	ErrorHandler(http.StatusBadRequest)(respw, req)
-	Log.Errord(JLData{"IP": req.RemoteAddr}, "CSRF detected!")
+	rejectToken(req)
+
+	return false
+}
+
+// verifyUpload checks the token of a multipart request before the first file is stored. The token has to be
+// sent as header or as form value preceding all files
+func (c *csrf) verifyUpload(req *http.Request, values map[string][]string) bool {
+	if !requiresToken(req) {
+		return true
+	}
+
+	submitted := req.Header.Get(CSRFHeader)
+	if submitted == "" && len(values["_csrf-token"]) != 0 {
+		submitted = values["_csrf-token"][0]
+	}
+
+	// new visitors can't have a valid token
+	if cookie, err := req.Cookie("JANTAR_ID"); err == nil && verifyToken(submitted, cookie.Value) {
+		return true
+	}
+
+	rejectToken(req)
+	return false
+}
+
+// requiresToken checks if a request has to carry the csrf token
+func requiresToken(req *http.Request) bool {
+	// check for safe methods. OPTIONS has to pass for cors preflights
+	if req.Method == "GET" || req.Method == "HEAD" || req.Method == "OPTIONS" {
+		return false
+	}
+
+	// endpoints receiving reports from browsers can't know the token
+	if route, ok := context.Get(req, "_Route").(*route); ok && route != nil && route.skipCSRF {
+		return false
+	}
+
+	return true
+}
+
+func rejectToken(req *http.Request) {
+	Log.Errord(JLData{"IP": ClientIP(req)}, "CSRF detected!")
+	getMetrics().incCSRFRejections()
+}
+
+func (c *csrf) isTrustedOrigin(origin string) bool {
+	if c.config == nil {
+		return false
+	}
+
+	for _, trusted := range c.config.TrustedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(trusted, "/"), origin) {
+			return true
+		}
+	}
 
-	/* log ip etc pp */
 	return false
 }
 
@@ -76,17 +148,58 @@ func beforeParseHook(tm *TemplateManager, name string, data *[]byte) {
 
 	offset := strings.Index(tmplData, "<head>")
 	if offset != -1 {
-		tmplData = tmplData[:offset+6] + "<meta name=\"csrf-token\" content=\"{{csrfToken}}\">" + tmplData[offset+6:]
+		tmplData = tmplData[:offset+6] + "<meta name=\"csrf-token\" content=\"{{csrfToken}}\"{{with cspNonce}} nonce=\"{{.}}\"{{end}}>" + tmplData[offset+6:]
 		*data = []byte(tmplData)
 	}
 }
 
+// maskToken xors the token with a random pad and prepends the pad. The rendered token changes with every
+// response which prevents BREACH style attacks from recovering it out of compressed responses
+func maskToken(token string) string {
+	pad := make([]byte, len(token))
+	if _, err := rand.Read(pad); err != nil {
+		Log.Fatal("failed to generate token mask")
+	}
+
+	masked := make([]byte, len(token))
+	for i := range masked {
+		masked[i] = token[i] ^ pad[i]
+	}
+
+	return hex.EncodeToString(pad) + hex.EncodeToString(masked)
+}
+
+// verifyToken compares a submitted token that might be masked with the token of the request
+func verifyToken(submitted string, token string) bool {
+	if len(submitted) == 4*len(token) {
+		if data, err := hex.DecodeString(submitted); err == nil {
+			pad, masked := data[:len(token)], data[len(token):]
+			for i := range masked {
+				masked[i] ^= pad[i]
+			}
+			submitted = string(masked)
+		}
+	}
+
+	return token != "" && subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) == 1
+}
+
+// beforeRenderHook binds the token of the request to the private template copy of the render. The function is
+// replaced for every render as the copy is reused by later requests
 func beforeRenderHook(req *http.Request, tm *TemplateManager, tmpl *template.Template, args map[string]interface{}) {
-	if token, ok := context.GetOk(req, "_csrf"); ok {
-		tmpl = tmpl.Funcs(template.FuncMap{
-			"csrfToken": func() string {
-				return token.(string)
-			},
-		})
+	var token string
+	if value, ok := context.GetOk(req, "_csrf"); ok {
+		// responses containing the token are excluded from compression if configured
+		context.Set(req, "_csrfRendered", true, true)
+		token = value.(string)
 	}
+
+	tmpl.Funcs(template.FuncMap{
+		"csrfToken": func() string {
+			if token == "" {
+				return ""
+			}
+			return maskToken(token)
+		},
+	})
 }
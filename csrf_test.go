@@ -0,0 +1,84 @@
+package jantar
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+// setupTemplate parses a single template the way the TemplateManager does including the csrf meta tag
+func setupTemplate(j *Jantar, name string, data string) {
+	fdata := []byte(data)
+	beforeParseHook(j.tm, name, &fdata)
+
+	j.tm.AddTmplFunc("csrfToken", func() string { return "" })
+	j.tm.AddHook(TmBeforeRender, beforeRenderHook)
+	j.tm.setTemplates(template.Must(template.New(name).Funcs(j.tm.tmplFuncs).Parse(string(fdata))))
+}
+
+func TestCSRFConcurrentRender(t *testing.T) {
+	var wg sync.WaitGroup
+	tokenRegexp := regexp.MustCompile(`name="csrf-token" content="([0-9a-f]+)"`)
+
+	j := setupServer(true)
+	setupTemplate(j, "index.html", "<html><head></head><body></body></html>")
+	j.AddRoute("GET", "/", func(rw http.ResponseWriter, r *http.Request) {
+		if err := j.tm.RenderTemplate(rw, r, "index.html", nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	/* every visitor gets a token for their own cookie */
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+
+			rw, req := testRequest("GET", "/")
+			req.AddCookie(&http.Cookie{Name: "JANTAR_ID", Value: id})
+			j.ServeHTTP(rw, req)
+
+			match := tokenRegexp.FindStringSubmatch(rw.Body.String())
+			if match == nil || !verifyToken(match[1], id) {
+				t.Errorf("Expected a token for %v, got %v.", id, rw.Body.String())
+			}
+		}(fmt.Sprintf("%064x", i))
+	}
+
+	wg.Wait()
+}
+
+func TestCSRFCookie(t *testing.T) {
+	tokenRegexp := regexp.MustCompile(`name="csrf-token" content="([0-9a-f]+)"`)
+
+	j := setupServer(true)
+	setupTemplate(j, "index.html", "<html><head></head><body></body></html>")
+	j.AddRoute("GET", "/", func(rw http.ResponseWriter, r *http.Request) {
+		j.tm.RenderTemplate(rw, r, "index.html", nil)
+	})
+	j.AddRoute("POST", "/", helloHandler)
+
+	/* the token rendered for a new visitor has to be accepted with the cookie set by the same response */
+	rw, req := testRequest("GET", "/")
+	j.ServeHTTP(rw, req)
+
+	cookies := rw.Result().Cookies()
+	match := tokenRegexp.FindStringSubmatch(rw.Body.String())
+	if len(cookies) != 1 || cookies[0].Name != "JANTAR_ID" || match == nil {
+		t.Fatalf("Expected JANTAR_ID cookie and token, got %v %v.", cookies, rw.Body.String())
+	}
+
+	for i := 0; i < 2; i++ {
+		rw, req = testRequest("POST", "/")
+		req.AddCookie(cookies[0])
+		req.Header.Set(CSRFHeader, match[1])
+		j.ServeHTTP(rw, req)
+
+		if rw.Code != http.StatusOK {
+			t.Errorf("Expected %v, got %v.", http.StatusOK, rw.Code)
+		}
+	}
+}
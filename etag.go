@@ -0,0 +1,279 @@
+package jantar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/tsurai/jantar/context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var hexRegexp = regexp.MustCompile("[0-9a-f]+")
+
+// ETagConfig configures the ETag middleware
+type ETagConfig struct {
+	// Weak generates weak ETags. Use weak ETags if the body differs in insignificant ways, e.g. by compression
+	Weak bool
+	// MaxSize is the maximal size in bytes of buffered responses. Larger responses are sent without ETag.
+	// Defaults to 1MB
+	MaxSize int
+	// Validator returns the current ETag and modification time of the resource a PUT or DELETE request refers to.
+	// If set, If-Match and If-Unmodified-Since are checked before the route handler runs
+	Validator func(req *http.Request) (etag string, modified time.Time)
+}
+
+// ETag is a Middleware that adds ETags to successful GET and HEAD responses and answers conditional
+// requests with 304 not modified. Handlers can provide their own validators by setting the ETag or
+// Last-Modified header or by calling CheckPreconditions. The masked csrf token and the csp nonce differ with
+// every render, so the ETag is computed with the unmasked token and without the nonce
+type ETag struct {
+	Middleware
+	config *ETagConfig
+}
+
+// etagWriter buffers a response until it is complete or exceeds the maximal size
+type etagWriter struct {
+	http.ResponseWriter
+	status      int
+	buf         bytes.Buffer
+	max         int
+	passthrough bool
+}
+
+// NewETag creates a new ETag Middleware. A nil config uses the default settings
+func NewETag(config *ETagConfig) *ETag {
+	if config == nil {
+		config = &ETagConfig{}
+	}
+
+	if config.MaxSize == 0 {
+		config.MaxSize = 1 << 20
+	}
+
+	return &ETag{config: config}
+}
+
+// ETagFor returns a quoted ETag for given data
+func ETagFor(data []byte, weak bool) string {
+	sum := sha256.Sum256(data)
+	etag := "\"" + hex.EncodeToString(sum[:16]) + "\""
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// Wrap implements the IHandlerMiddleware interface
+// Note: Do not call this yourself
+func (e *ETag) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(respw http.ResponseWriter, req *http.Request) {
+		if (req.Method == "PUT" || req.Method == "DELETE") && e.config.Validator != nil {
+			etag, modified := e.config.Validator(req)
+			if !CheckPreconditions(respw, req, etag, modified) {
+				return
+			}
+		}
+
+		if req.Method != "GET" && req.Method != "HEAD" {
+			next.ServeHTTP(respw, req)
+			return
+		}
+
+		ew := &etagWriter{ResponseWriter: respw, max: e.config.MaxSize}
+		next.ServeHTTP(ew, req)
+
+		if ew.passthrough {
+			return
+		}
+
+		if ew.status == 0 {
+			ew.status = http.StatusOK
+		}
+
+		header := respw.Header()
+		if ew.status == http.StatusOK && !strings.Contains(header.Get("Cache-Control"), "no-store") {
+			// handlers might skip the body of HEAD requests so their ETag would differ from GET
+			if header.Get("ETag") == "" && (req.Method == "GET" || ew.buf.Len() > 0) {
+				header.Set("ETag", ETagFor(stableBody(req, ew.buf.Bytes()), e.config.Weak))
+			}
+
+			if isNotModified(req, header.Get("ETag"), parseHTTPTime(header.Get("Last-Modified"))) {
+				writeNotModified(respw)
+				return
+			}
+		}
+
+		respw.WriteHeader(ew.status)
+		respw.Write(ew.buf.Bytes())
+	})
+}
+
+// stableBody returns the body of a response with the values that change with every render replaced by
+// their value for the whole session
+func stableBody(req *http.Request, body []byte) []byte {
+	if _, ok := context.GetOk(req, "_csrfRendered"); ok {
+		if token, ok := context.Get(req, "_csrf").(string); ok && token != "" {
+			body = hexRegexp.ReplaceAllFunc(body, func(match []byte) []byte {
+				if len(match) == 4*len(token) && verifyToken(string(match), token) {
+					return []byte(token)
+				}
+				return match
+			})
+		}
+	}
+
+	if nonce, ok := context.Get(req, "_CSPNonce").(string); ok && nonce != "" {
+		body = bytes.Replace(body, []byte(nonce), nil, -1)
+	}
+
+	return body
+}
+
+func (w *etagWriter) WriteHeader(status int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(status)
+	} else if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *etagWriter) Write(data []byte) (int, error) {
+	if !w.passthrough && w.buf.Len()+len(data) > w.max {
+		w.flushBuffer()
+	}
+
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+// Flush sends the buffered data. Streamed responses don't get an ETag
+func (w *etagWriter) Flush() {
+	if !w.passthrough {
+		w.flushBuffer()
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *etagWriter) flushBuffer() {
+	w.passthrough = true
+
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+}
+
+// CheckPreconditions evaluates the conditional headers of a request against the current ETag and modification
+// time of the requested resource. An empty etag or zero time means the validator is unknown. It responds with
+// 304 not modified or 412 precondition failed and returns false if the request must not be processed any further
+func CheckPreconditions(respw http.ResponseWriter, req *http.Request, etag string, modified time.Time) bool {
+	safe := req.Method == "GET" || req.Method == "HEAD"
+
+	if safe {
+		if etag != "" {
+			respw.Header().Set("ETag", etag)
+		}
+		if !modified.IsZero() {
+			respw.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+		}
+	}
+
+	failed := false
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" {
+		failed = !matchETag(ifMatch, etag, false)
+	} else if since := parseHTTPTime(req.Header.Get("If-Unmodified-Since")); !since.IsZero() && !modified.IsZero() {
+		failed = modified.Truncate(time.Second).After(since)
+	}
+
+	if !failed && !safe && req.Header.Get("If-None-Match") != "" {
+		failed = matchETag(req.Header.Get("If-None-Match"), etag, true)
+	}
+
+	if failed {
+		Log.Debugd(JLData{"method": req.Method, "path": req.URL.Path}, "precondition failed")
+		ErrorHandler(http.StatusPreconditionFailed)(respw, req)
+		return false
+	}
+
+	if safe && isNotModified(req, etag, modified) {
+		writeNotModified(respw)
+		return false
+	}
+
+	return true
+}
+
+// CheckPreconditions evaluates the conditional headers of the current request. See CheckPreconditions
+func (c *Controller) CheckPreconditions(etag string, modified time.Time) bool {
+	return CheckPreconditions(c.Respw, c.Req, etag, modified)
+}
+
+// isNotModified checks If-None-Match and, if absent, If-Modified-Since of a GET or HEAD request
+func isNotModified(req *http.Request, etag string, modified time.Time) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return matchETag(ifNoneMatch, etag, true)
+	}
+
+	since := parseHTTPTime(req.Header.Get("If-Modified-Since"))
+	return !since.IsZero() && !modified.IsZero() && !modified.Truncate(time.Second).After(since)
+}
+
+// matchETag checks if etag is contained in a list of ETags. Strong comparison never matches weak ETags
+func matchETag(list string, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseHTTPTime(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func writeNotModified(respw http.ResponseWriter) {
+	header := respw.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	respw.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,106 @@
+package jantar
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETag(t *testing.T) {
+	modified := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	version := `"v1"`
+
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	j := setupServer(false)
+	j.AddMiddleware(NewETag(&ETagConfig{
+		Validator: func(r *http.Request) (string, time.Time) { return version, modified },
+	}))
+	j.AddRoute("GET", "/", helloHandler)
+	j.AddRoute("GET", "/modified", func(rw http.ResponseWriter, r *http.Request) {
+		if CheckPreconditions(rw, r, "", modified) {
+			rw.Write([]byte("content"))
+		}
+	})
+	j.AddRoute("PUT", "/", helloHandler)
+
+	/* generated etags and If-None-Match */
+	rw, req := testRequest("GET", "/")
+	j.ServeHTTP(rw, req)
+
+	etag := rw.Header().Get("ETag")
+	assertEqual(http.StatusOK, rw.Code)
+	assertEqual(etag, ETagFor(rw.Body.Bytes(), false))
+
+	rw, req = testRequest("GET", "/")
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	j.ServeHTTP(rw, req)
+
+	assertEqual(http.StatusNotModified, rw.Code)
+	assertEqual(0, rw.Body.Len())
+
+	/* handler provided validators and If-Modified-Since */
+	for since, status := range map[time.Time]int{modified: http.StatusNotModified, modified.Add(-time.Hour): http.StatusOK} {
+		rw, req = testRequest("GET", "/modified")
+		req.Header.Set("If-Modified-Since", since.Format(http.TimeFormat))
+		j.ServeHTTP(rw, req)
+
+		assertEqual(status, rw.Code)
+		assertEqual(modified.Format(http.TimeFormat), rw.Header().Get("Last-Modified"))
+	}
+
+	/* If-Match preconditions */
+	for ifMatch, status := range map[string]int{`"v1"`: http.StatusOK, `"v0"`: http.StatusPreconditionFailed, `W/"v1"`: http.StatusPreconditionFailed, "*": http.StatusOK} {
+		rw, req = testRequest("PUT", "/")
+		req.Header.Set("If-Match", ifMatch)
+		j.ServeHTTP(rw, req)
+
+		assertEqual(status, rw.Code)
+	}
+}
+
+func TestETagCSRF(t *testing.T) {
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	j := setupServer(true)
+	j.AddMiddleware(NewETag(nil))
+	setupTemplate(j, "index.html", "<html><head></head><body><input value=\"{{csrfToken}}\"></body></html>")
+	j.AddRoute("GET", "/", func(rw http.ResponseWriter, r *http.Request) {
+		j.tm.RenderTemplate(rw, r, "index.html", nil)
+	}).SecurityHeaders(&SecurityHeaders{ContentSecurityPolicy: "default-src 'self'", CSPNonce: true})
+
+	serve := func(id string, etag string) *httptest.ResponseRecorder {
+		rw, req := testRequest("GET", "/")
+		req.AddCookie(&http.Cookie{Name: "JANTAR_ID", Value: id})
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		j.ServeHTTP(rw, req)
+		return rw
+	}
+
+	/* masked tokens and nonces differ with every render but the ETag of a visitor doesn't */
+	first, second := serve(strings.Repeat("a", 64), ""), serve(strings.Repeat("a", 64), "")
+	if first.Body.String() == second.Body.String() {
+		t.Errorf("Expected differently masked tokens.")
+	}
+	assertEqual(first.Header().Get("ETag"), second.Header().Get("ETag"))
+	assertEqual(http.StatusNotModified, serve(strings.Repeat("a", 64), first.Header().Get("ETag")).Code)
+
+	/* other visitors get another token */
+	other := serve(strings.Repeat("b", 64), first.Header().Get("ETag"))
+	assertEqual(http.StatusOK, other.Code)
+	if other.Header().Get("ETag") == first.Header().Get("ETag") {
+		t.Errorf("Expected the ETag to depend on the token.")
+	}
+}
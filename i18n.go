@@ -0,0 +1,413 @@
+package jantar
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/tsurai/jantar/context"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// I18nConfig configures the message catalogs and how the locale of a request is resolved
+type I18nConfig struct {
+	// Directory contains the message files named <name>.<locale> e.g. "app.en" or "app.de-at". Defaults to "messages"
+	Directory string
+	// DefaultLocale is used if no other locale matches. Defaults to "en"
+	DefaultLocale string
+	// URLPrefix enables locale prefixes like "/de/posts". The prefix is stripped before routing
+	URLPrefix bool
+	// CookieName is the cookie holding the locale chosen by the user. Defaults to "JANTAR_LANG"
+	CookieName string
+}
+
+// PluralRule returns the plural category ("zero", "one", "two", "few", "many" or "other") for n
+type PluralRule func(n int) string
+
+// I18n holds the message catalogs of all locales. Messages are looked up in the requested locale, its base
+// language and the default locale, in that order. A message can have plural forms by adding the category to
+// its key like "items.one" and "items.other". Arguments are interpolated with fmt.Sprintf
+type I18n struct {
+	mutex    sync.RWMutex
+	config   *I18nConfig
+	catalogs map[string]map[string]string
+	plurals  map[string]PluralRule
+}
+
+var defaultMessages = map[string]string{
+	"since.now":          "< 1 minute ago",
+	"since.minute.one":   "%d minute ago",
+	"since.minute.other": "%d minutes ago",
+	"since.hour.one":     "%d hour ago",
+	"since.hour.other":   "%d hours ago",
+	"since.day.one":      "%d day ago",
+	"since.day.other":    "%d days ago",
+	"since.month.one":    "%d month ago",
+	"since.month.other":  "%d months ago",
+	"since.year":         "> 1 year ago",
+}
+
+func pluralOneOther(n int) string {
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func pluralSlavic(n int) string {
+	if n%10 == 1 && n%100 != 11 {
+		return "one"
+	} else if n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14) {
+		return "few"
+	}
+	return "many"
+}
+
+func newI18n(config *I18nConfig) *I18n {
+	if config.Directory == "" {
+		config.Directory = "messages"
+	}
+
+	if config.DefaultLocale == "" {
+		config.DefaultLocale = "en"
+	}
+
+	if config.CookieName == "" {
+		config.CookieName = "JANTAR_LANG"
+	}
+
+	config.DefaultLocale = normalizeLocale(config.DefaultLocale)
+
+	return &I18n{
+		config:   config,
+		catalogs: make(map[string]map[string]string),
+		plurals: map[string]PluralRule{
+			"fr": func(n int) string {
+				if n == 0 || n == 1 {
+					return "one"
+				}
+				return "other"
+			},
+			"ja": func(n int) string { return "other" },
+			"zh": func(n int) string { return "other" },
+			"ko": func(n int) string { return "other" },
+			"ru": pluralSlavic,
+			"uk": pluralSlavic,
+			"pl": func(n int) string {
+				if n == 1 {
+					return "one"
+				}
+				if category := pluralSlavic(n); category == "few" {
+					return category
+				}
+				return "many"
+			},
+			"cs": func(n int) string {
+				if n == 1 {
+					return "one"
+				} else if n >= 2 && n <= 4 {
+					return "few"
+				}
+				return "other"
+			},
+		},
+	}
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(locale), "_", "-", -1))
+}
+
+func baseLanguage(locale string) string {
+	if i := strings.Index(locale, "-"); i != -1 {
+		return locale[:i]
+	}
+	return locale
+}
+
+// AddPluralRule sets the plural rule for a language like "de" or a locale like "de-at". Languages without
+// a rule use "one" for 1 and "other" for everything else
+func (i *I18n) AddPluralRule(locale string, rule PluralRule) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.plurals[normalizeLocale(locale)] = rule
+}
+
+// Locales returns all locales a catalog has been loaded for
+func (i *I18n) Locales() []string {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	var locales []string
+	for locale := range i.catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	return locales
+}
+
+// HasLocale checks if a catalog for a given locale has been loaded
+func (i *I18n) HasLocale(locale string) bool {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	_, ok := i.catalogs[normalizeLocale(locale)]
+	return ok
+}
+
+func (i *I18n) loadCatalogs() error {
+	catalogs := make(map[string]map[string]string)
+
+	if _, err := os.Stat(i.config.Directory); os.IsNotExist(err) {
+		return nil
+	}
+
+	err := filepath.Walk(i.config.Directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") || filepath.Ext(path) == "" {
+			return nil
+		}
+
+		locale := normalizeLocale(filepath.Ext(path)[1:])
+		if catalogs[locale] == nil {
+			catalogs[locale] = make(map[string]string)
+		}
+
+		return parseMessageFile(path, catalogs[locale])
+	})
+
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	i.catalogs = catalogs
+	i.mutex.Unlock()
+
+	Log.Debugd(JLData{"locales": i.Locales()}, "loaded message catalogs")
+
+	return nil
+}
+
+// parseMessageFile reads "key = value" lines. Empty lines and lines starting with # are ignored
+func parseMessageFile(path string, catalog map[string]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		offset := strings.Index(line, "=")
+		if offset == -1 {
+			return fmt.Errorf("%s:%d: missing '='", path, n)
+		}
+
+		catalog[strings.TrimSpace(line[:offset])] = strings.Replace(strings.TrimSpace(line[offset+1:]), "\\n", "\n", -1)
+	}
+
+	return scanner.Err()
+}
+
+func (i *I18n) lookup(locale string, key string) (string, bool) {
+	for _, l := range []string{locale, baseLanguage(locale), i.config.DefaultLocale} {
+		if msg, ok := i.catalogs[l][key]; ok {
+			return msg, true
+		}
+	}
+
+	msg, ok := defaultMessages[key]
+	return msg, ok
+}
+
+func (i *I18n) pluralCategory(locale string, n int) string {
+	if rule, ok := i.plurals[locale]; ok {
+		return rule(n)
+	} else if rule, ok := i.plurals[baseLanguage(locale)]; ok {
+		return rule(n)
+	}
+	return pluralOneOther(n)
+}
+
+// Translate returns the message for key in the given locale. If the message has plural forms the first integer
+// argument selects the form. Unknown keys are returned unchanged
+func (i *I18n) Translate(locale string, key string, args ...interface{}) string {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	locale = normalizeLocale(locale)
+	msg, ok := i.lookup(locale, key)
+
+	if !ok {
+		for _, arg := range args {
+			if n, isInt := arg.(int); isInt {
+				if msg, ok = i.lookup(locale, key+"."+i.pluralCategory(locale, n)); !ok {
+					msg, ok = i.lookup(locale, key+".other")
+				}
+				break
+			}
+		}
+	}
+
+	if !ok {
+		return key
+	}
+
+	if len(args) > 0 && strings.Contains(msg, "%") {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Since returns a localized description of the time passed since t like "5 minutes ago"
+func (i *I18n) Since(locale string, t time.Time) string {
+	seconds := int(time.Since(t).Seconds())
+
+	switch {
+	case seconds < 60:
+		return i.Translate(locale, "since.now")
+	case seconds < 60*60:
+		return i.Translate(locale, "since.minute", seconds/60)
+	case seconds < 60*60*24:
+		return i.Translate(locale, "since.hour", seconds/(60*60))
+	case seconds < 60*60*24*30:
+		return i.Translate(locale, "since.day", seconds/(60*60*24))
+	case seconds < 60*60*24*30*12:
+		return i.Translate(locale, "since.month", seconds/(60*60*24*30))
+	}
+	return i.Translate(locale, "since.year")
+}
+
+// resolveLocale determines the locale of a request from the url prefix, the locale cookie and the
+// Accept-Language header, in that order
+func (i *I18n) resolveLocale(req *http.Request) string {
+	locale := ""
+
+	if i.config.URLPrefix {
+		segments := splitPath(req.URL.Path)
+		if len(segments) > 0 && i.HasLocale(segments[0]) {
+			locale = normalizeLocale(segments[0])
+			req.URL.Path = "/" + strings.Join(segments[1:], "/")
+		}
+	}
+
+	if locale == "" {
+		if cookie, err := req.Cookie(i.config.CookieName); err == nil && i.HasLocale(cookie.Value) {
+			locale = normalizeLocale(cookie.Value)
+		}
+	}
+
+	if locale == "" {
+		locale = i.matchAcceptLanguage(req.Header.Get("Accept-Language"))
+	}
+
+	context.Set(req, "_Locale", locale, true)
+	if args, ok := context.GetOk(req, "_RenderArgs"); ok {
+		args.(map[string]interface{})["currentLocale"] = locale
+	}
+
+	return locale
+}
+
+func (i *I18n) matchAcceptLanguage(header string) string {
+	type language struct {
+		locale string
+		q      float64
+	}
+
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		l := language{normalizeLocale(fields[0]), 1}
+
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					l.q = q
+				}
+			}
+		}
+
+		if l.locale != "" && l.q > 0 {
+			languages = append(languages, l)
+		}
+	}
+
+	sort.SliceStable(languages, func(a, b int) bool { return languages[a].q > languages[b].q })
+
+	for _, l := range languages {
+		if i.HasLocale(l.locale) {
+			return l.locale
+		} else if i.HasLocale(baseLanguage(l.locale)) {
+			return baseLanguage(l.locale)
+		}
+	}
+
+	return i.config.DefaultLocale
+}
+
+// requestLocale returns the resolved locale of a request or the default locale
+func (i *I18n) requestLocale(req *http.Request) string {
+	if locale, ok := context.GetOk(req, "_Locale"); ok {
+		return locale.(string)
+	}
+	return i.config.DefaultLocale
+}
+
+// beforeRenderHook binds the locale of the request to the private template copy of the render
+func (i *I18n) beforeRenderHook(req *http.Request, tm *TemplateManager, tmpl *template.Template, args map[string]interface{}) {
+	locale := i.requestLocale(req)
+
+	tmpl.Funcs(template.FuncMap{
+		"msg": func(key string, args ...interface{}) string {
+			return i.Translate(locale, key, args...)
+		},
+		"since": func(t time.Time) string {
+			return i.Since(locale, t)
+		},
+	})
+}
+
+// translateRequest translates a message into the locale of a given request
+func translateRequest(req *http.Request, key string, args ...interface{}) string {
+	i, ok := GetModule(ModuleI18n).(*I18n)
+	if !ok || i == nil {
+		if msg, ok := defaultMessages[key]; ok {
+			return msg
+		}
+		return key
+	}
+
+	return i.Translate(i.requestLocale(req), key, args...)
+}
+
+// Locale returns the resolved locale of the current request
+func (c *Controller) Locale() string {
+	if locale, ok := context.GetOk(c.Req, "_Locale"); ok {
+		return locale.(string)
+	}
+	return ""
+}
+
+// Message returns the message for key translated into the locale of the current request
+func (c *Controller) Message(key string, args ...interface{}) string {
+	return translateRequest(c.Req, key, args...)
+}
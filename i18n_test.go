@@ -0,0 +1,112 @@
+package jantar
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestI18n(t *testing.T) {
+	assertEqual := func(val interface{}, exp interface{}) {
+		if val != exp {
+			t.Errorf("Expected %v, got %v.", exp, val)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "jantar-messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "app.de"), []byte("# german\ngreeting = Hallo %s\nitems.one = ein Eintrag\nitems.other = %d Einträge\nsince.minute.other = vor %d Minuten\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app.en"), []byte("greeting = Hello %s\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app.ru"), []byte("items.one = %d запись\nitems.few = %d записи\nitems.many = %d записей\n"), 0644)
+
+	setupServer(false)
+	i := newI18n(&I18nConfig{Directory: dir, URLPrefix: true})
+	if err := i.loadCatalogs(); err != nil {
+		t.Fatal(err)
+	}
+
+	/* interpolation and fallbacks */
+	assertEqual(i.Translate("de-AT", "greeting", "Welt"), "Hallo Welt")
+	assertEqual(i.Translate("fr", "greeting", "monde"), "Hello monde")
+	assertEqual(i.Translate("de", "unknown"), "unknown")
+
+	/* plural rules */
+	assertEqual(i.Translate("de", "items", 1), "ein Eintrag")
+	assertEqual(i.Translate("de", "items", 3), "3 Einträge")
+	assertEqual(i.Translate("ru", "items", 21), "21 запись")
+	assertEqual(i.Translate("ru", "items", 3), "3 записи")
+	assertEqual(i.Translate("ru", "items", 11), "11 записей")
+
+	/* localized since with english defaults */
+	assertEqual(i.Since("de", time.Now().Add(-5*time.Minute)), "vor 5 Minuten")
+	assertEqual(i.Since("en", time.Now().Add(-time.Hour)), "1 hour ago")
+
+	/* locale resolution */
+	req, _ := http.NewRequest("GET", "/ru/posts", nil)
+	req.Header.Set("Accept-Language", "de-CH, en;q=0.8")
+	assertEqual(i.resolveLocale(req), "ru")
+	assertEqual(req.URL.Path, "/posts")
+
+	req, _ = http.NewRequest("GET", "/posts", nil)
+	req.Header.Set("Accept-Language", "fr;q=0.9, de-CH, en;q=0.8")
+	assertEqual(i.resolveLocale(req), "de")
+
+	req.AddCookie(&http.Cookie{Name: "JANTAR_LANG", Value: "en"})
+	assertEqual(i.resolveLocale(req), "en")
+}
+
+func TestI18nConcurrentRender(t *testing.T) {
+	var wg sync.WaitGroup
+
+	dir, err := ioutil.TempDir("", "jantar-messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "app.de"), []byte("greeting = Hallo\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app.en"), []byte("greeting = Hello\n"), 0644)
+
+	j := New(&Config{I18n: &I18nConfig{Directory: dir}})
+	j.middleware = nil
+	Log.SetMinLevel(LogLevelPanic)
+	if err := j.i18n.loadCatalogs(); err != nil {
+		t.Fatal(err)
+	}
+
+	setupTemplate(j, "index.html", `<p>{{msg "greeting"}}</p>`)
+	j.AddRoute("GET", "/", func(rw http.ResponseWriter, r *http.Request) {
+		if err := j.tm.RenderTemplate(rw, r, "index.html", nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	locales := [][2]string{{"de", "Hallo"}, {"en", "Hello"}}
+
+	/* every page is rendered in the locale of its own request */
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(locale string, expected string) {
+			defer wg.Done()
+
+			rw, req := testRequest("GET", "/")
+			req.AddCookie(&http.Cookie{Name: "JANTAR_LANG", Value: locale})
+			j.ServeHTTP(rw, req)
+
+			if !strings.Contains(rw.Body.String(), expected) {
+				t.Errorf("Expected %v, got %v.", expected, rw.Body.String())
+			}
+		}(locales[i%2][0], locales[i%2][1])
+	}
+
+	wg.Wait()
+}
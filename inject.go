@@ -0,0 +1,194 @@
+package jantar
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Service error codes
+var (
+	ErrServiceInvalid   = errors.New("service is nil")
+	ErrServiceDuplicate = errors.New("service already registered")
+	ErrServiceMissing   = errors.New("required service not registered")
+	ErrServiceAmbiguous = errors.New("more than one service matches")
+)
+
+// services is a registry of application services that are injected into controller fields tagged with
+// `inject:""` (by type) or `inject:"name"` (by name). Adding ",optional" to the tag allows the service to be missing
+type services struct {
+	mutex  sync.RWMutex
+	byName map[string]reflect.Value
+	byType []reflect.Value
+	plans  map[reflect.Type][]injection
+}
+
+type injection struct {
+	index int
+	value reflect.Value
+}
+
+func newServices() *services {
+	return &services{byName: make(map[string]reflect.Value), plans: make(map[reflect.Type][]injection)}
+}
+
+// Provide registers a service that is injected into every controller field tagged with `inject:""`
+// whose type the service is assignable to
+func (j *Jantar) Provide(service interface{}) error {
+	return j.services.provide("", service)
+}
+
+// ProvideNamed registers a service that is injected into every controller field tagged with `inject:"name"`
+func (j *Jantar) ProvideNamed(name string, service interface{}) error {
+	if name == "" {
+		return errors.New("service name must not be empty")
+	}
+	return j.services.provide(name, service)
+}
+
+func (s *services) provide(name string, service interface{}) error {
+	if service == nil {
+		return ErrServiceInvalid
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	value := reflect.ValueOf(service)
+
+	if name != "" {
+		if _, ok := s.byName[name]; ok {
+			Log.Errord(JLData{"name": name}, "failed to provide service: name already in use")
+			return ErrServiceDuplicate
+		}
+		s.byName[name] = value
+	} else {
+		for _, v := range s.byType {
+			if v.Type() == value.Type() {
+				Log.Errord(JLData{"type": value.Type()}, "failed to provide service: type already in use")
+				return ErrServiceDuplicate
+			}
+		}
+		s.byType = append(s.byType, value)
+	}
+
+	// services may change the injection plans
+	s.plans = make(map[reflect.Type][]injection)
+
+	return nil
+}
+
+func parseInjectTag(tag string) (string, bool) {
+	parts := strings.Split(tag, ",")
+	optional := false
+
+	for _, opt := range parts[1:] {
+		if strings.TrimSpace(opt) == "optional" {
+			optional = true
+		}
+	}
+
+	return strings.TrimSpace(parts[0]), optional
+}
+
+// resolve finds the service for a single field. Missing optional services return an invalid reflect.Value
+func (s *services) resolve(field reflect.StructField) (reflect.Value, error) {
+	name, optional := parseInjectTag(field.Tag.Get("inject"))
+
+	var found []reflect.Value
+	if name != "" {
+		if v, ok := s.byName[name]; ok && v.Type().AssignableTo(field.Type) {
+			found = append(found, v)
+		}
+	} else {
+		for _, v := range s.byType {
+			if v.Type() == field.Type {
+				// exact matches take precedence over interface implementations
+				found = []reflect.Value{v}
+				break
+			} else if v.Type().AssignableTo(field.Type) {
+				found = append(found, v)
+			}
+		}
+	}
+
+	switch {
+	case len(found) == 1:
+		return found[0], nil
+	case len(found) > 1:
+		return reflect.Value{}, ErrServiceAmbiguous
+	case optional:
+		return reflect.Value{}, nil
+	}
+
+	return reflect.Value{}, ErrServiceMissing
+}
+
+// plan computes and caches which services have to be injected into a given controller type
+func (s *services) plan(t reflect.Type) ([]injection, error) {
+	s.mutex.RLock()
+	plan, ok := s.plans[t]
+	s.mutex.RUnlock()
+
+	if ok {
+		return plan, nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := field.Tag.Lookup("inject"); !ok {
+			continue
+		}
+
+		if field.PkgPath != "" {
+			return nil, fmt.Errorf("field %s.%s is unexported and can't be injected", t.Name(), field.Name)
+		}
+
+		value, err := s.resolve(field)
+		if err != nil {
+			return nil, fmt.Errorf("field %s.%s of type %s: %s", t.Name(), field.Name, field.Type, err.Error())
+		}
+
+		if value.IsValid() {
+			plan = append(plan, injection{i, value})
+		}
+	}
+
+	s.plans[t] = plan
+
+	return plan, nil
+}
+
+// check makes sure that all required services of every controller route are registered
+func (s *services) check(r *router) error {
+	for _, route := range r.namedRoutes {
+		if route.cType == nil {
+			continue
+		}
+
+		if _, err := s.plan(route.cType); err != nil {
+			Log.Errord(JLData{"error": err}, "failed to inject services")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inject sets all services of the controller c of type t
+func (s *services) inject(t reflect.Type, c reflect.Value) {
+	plan, err := s.plan(t)
+	if err != nil {
+		Log.Errord(JLData{"error": err}, "failed to inject services")
+		return
+	}
+
+	for _, inj := range plan {
+		c.Field(inj.index).Set(inj.value)
+	}
+}
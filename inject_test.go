@@ -0,0 +1,53 @@
+package jantar
+
+import (
+	"fmt"
+	"testing"
+)
+
+type greeter interface {
+	Greet() string
+}
+
+type englishGreeter struct{}
+
+func (g *englishGreeter) Greet() string {
+	return "hello"
+}
+
+type injectController struct {
+	Controller
+	Greeter greeter `inject:""`
+	Name    string  `inject:"name"`
+	Cache   *int    `inject:",optional"`
+}
+
+func (c *injectController) Index() {
+	fmt.Fprintf(c.Respw, "%s %s %v", c.Greeter.Greet(), c.Name, c.Cache == nil)
+}
+
+func TestInject(t *testing.T) {
+	j := setupServer(false)
+	j.AddRoute("GET", "/", (*injectController).Index)
+
+	if err := j.services.check(j.router); err == nil {
+		t.Errorf("Expected missing services to fail the startup check")
+	}
+
+	j.Provide(&englishGreeter{})
+	j.ProvideNamed("name", "jantar")
+
+	if err := j.Provide(&englishGreeter{}); err != ErrServiceDuplicate {
+		t.Errorf("Expected %v, got %v.", ErrServiceDuplicate, err)
+	}
+
+	if err := j.services.check(j.router); err != nil {
+		t.Errorf("Expected startup check to pass, got %v.", err)
+	}
+
+	rw, req := testRequest("GET", "/")
+	j.ServeHTTP(rw, req)
+	if body := rw.Body.String(); body != "hello jantar true" {
+		t.Errorf("Expected 'hello jantar true', got '%s'.", body)
+	}
+}
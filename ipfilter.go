@@ -0,0 +1,223 @@
+package jantar
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/howeyc/fsnotify"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// IPFilterConfig configures the IPFilter middleware. Entries are ip addresses or CIDRs like "10.0.0.0/8"
+// or "2001:db8::/32"
+type IPFilterConfig struct {
+	// Allow lists the only clients allowed to access the filtered paths. An empty list allows every client
+	Allow []string
+	// Deny lists clients that are never allowed. Deny takes precedence over Allow
+	Deny []string
+	// Paths limits the filter to path prefixes like "/admin". An empty list filters every request
+	Paths []string
+	// File contains additional entries, one per line, as "allow <cidr>" or "deny <cidr>". Lines starting
+	// with # are ignored. The file is reloaded whenever it changes
+	File string
+}
+
+// IPFilter is a Middleware that rejects clients by their resolved ip address with 403 forbidden
+type IPFilter struct {
+	Middleware
+	config  *IPFilterConfig
+	mutex   sync.RWMutex
+	allow   []*net.IPNet
+	deny    []*net.IPNet
+	watcher *fsnotify.Watcher
+}
+
+// NewIPFilter creates a new ip filter Middleware
+func NewIPFilter(config *IPFilterConfig) *IPFilter {
+	if config == nil {
+		config = &IPFilterConfig{}
+	}
+
+	f := &IPFilter{config: config}
+	if err := f.load(); err != nil {
+		Log.Fatald(JLData{"error": err}, "failed to load ip filter")
+	}
+
+	return f
+}
+
+// Initialize starts watching the filter file
+// Note: Do not call this yourself
+func (f *IPFilter) Initialize() {
+	if f.config.File == "" {
+		return
+	}
+
+	var err error
+	if f.watcher, err = fsnotify.NewWatcher(); err != nil {
+		Log.Warningd(JLData{"error": err}, "can't watch ip filter file")
+		return
+	}
+
+	// watch the directory as editors often replace files instead of writing to them
+	if err = f.watcher.Watch(filepath.Dir(f.config.File)); err != nil {
+		Log.Warningd(JLData{"error": err, "file": f.config.File}, "can't watch ip filter file")
+		return
+	}
+
+	go f.watch()
+}
+
+// Cleanup stops watching the filter file
+// Note: Do not call this yourself
+func (f *IPFilter) Cleanup() {
+	if f.watcher != nil {
+		f.watcher.Close()
+	}
+}
+
+func (f *IPFilter) watch() {
+	for {
+		select {
+		case ev, ok := <-f.watcher.Event:
+			if !ok {
+				return
+			}
+
+			if filepath.Clean(ev.Name) == filepath.Clean(f.config.File) && !ev.IsDelete() && !ev.IsRename() {
+				if err := f.Reload(); err != nil {
+					Log.Warningd(JLData{"error": err, "file": f.config.File}, "failed to reload ip filter. Keeping the previous lists")
+				}
+			}
+		case err, ok := <-f.watcher.Error:
+			if !ok {
+				return
+			}
+			Log.Warningd(JLData{"error": err}, "file watcher error")
+		}
+	}
+}
+
+// Reload reads the filter file again. The current lists are kept if the file is invalid
+func (f *IPFilter) Reload() error {
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	Log.Infod(JLData{"file": f.config.File}, "reloaded ip filter")
+	return nil
+}
+
+func (f *IPFilter) load() error {
+	allowList := append([]string{}, f.config.Allow...)
+	denyList := append([]string{}, f.config.Deny...)
+
+	if f.config.File != "" {
+		fileAllow, fileDeny, err := parseIPFilterFile(f.config.File)
+		if err != nil {
+			return err
+		}
+		allowList = append(allowList, fileAllow...)
+		denyList = append(denyList, fileDeny...)
+	}
+
+	allow, err := parseNetworks(allowList)
+	if err != nil {
+		return err
+	}
+
+	deny, err := parseNetworks(denyList)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	f.allow, f.deny = allow, deny
+	f.mutex.Unlock()
+
+	return nil
+}
+
+func parseIPFilterFile(path string) ([]string, []string, error) {
+	var allow, deny []string
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("%s:%d: expected '<allow|deny> <cidr>'", path, n)
+		}
+
+		switch strings.ToLower(fields[0]) {
+		case "allow":
+			allow = append(allow, fields[1])
+		case "deny":
+			deny = append(deny, fields[1])
+		default:
+			return nil, nil, fmt.Errorf("%s:%d: unknown rule '%s'", path, n, fields[0])
+		}
+	}
+
+	return allow, deny, scanner.Err()
+}
+
+// Allowed checks if a client ip is allowed by the current lists
+func (f *IPFilter) Allowed(ip net.IP) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if containsIP(f.deny, ip) {
+		return false
+	}
+
+	return len(f.allow) == 0 || containsIP(f.allow, ip)
+}
+
+func (f *IPFilter) isFiltered(path string) bool {
+	if len(f.config.Paths) == 0 {
+		return true
+	}
+
+	for _, prefix := range f.config.Paths {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// WebSocket implements the IWebSocketMiddleware interface
+func (f *IPFilter) WebSocket() {}
+
+// Call executes the Middleware
+// Note: Do not call this yourself
+func (f *IPFilter) Call(respw http.ResponseWriter, req *http.Request) bool {
+	if !f.isFiltered(req.URL.Path) {
+		return true
+	}
+
+	ip := ClientIP(req)
+	if f.Allowed(net.ParseIP(ip)) {
+		return true
+	}
+
+	Log.Warningd(JLData{"IP": ip, "path": req.URL.Path}, "ip address not allowed")
+	ErrorHandler(http.StatusForbidden)(respw, req)
+
+	return false
+}
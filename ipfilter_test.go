@@ -0,0 +1,67 @@
+package jantar
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	j := setupServer(false)
+	j.AddMiddleware(NewIPFilter(&IPFilterConfig{
+		Allow: []string{"10.0.0.0/8", "2001:db8::/32"},
+		Deny:  []string{"10.0.0.66"},
+		Paths: []string{"/admin"},
+	}))
+	j.AddRoute("GET", "/admin", helloHandler)
+	j.AddRoute("GET", "/administration", helloHandler)
+
+	for _, test := range []struct {
+		remote string
+		path   string
+		status int
+	}{
+		{"10.1.2.3:1234", "/admin", 200},
+		{"[2001:db8::1]:1234", "/admin", 200},
+		{"10.0.0.66:1234", "/admin", 403},
+		{"192.0.2.1:1234", "/admin", 403},
+		{"192.0.2.1:1234", "/administration", 200},
+	} {
+		rw, req := testRequest("GET", test.path)
+		req.RemoteAddr = test.remote
+		j.ServeHTTP(rw, req)
+
+		if rw.Code != test.status {
+			t.Errorf("Expected %s on %s to get %d, got %d.", test.remote, test.path, test.status, rw.Code)
+		}
+	}
+}
+
+func TestIPFilterFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jantar-ipfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "ipfilter")
+	ioutil.WriteFile(file, []byte("# office\nallow 192.0.2.0/24\ndeny 192.0.2.1\n"), 0600)
+
+	f := NewIPFilter(&IPFilterConfig{File: file})
+	if f.Allowed(net.ParseIP("192.0.2.1")) || !f.Allowed(net.ParseIP("192.0.2.2")) || f.Allowed(net.ParseIP("198.51.100.1")) {
+		t.Errorf("Expected file entries to be applied.")
+	}
+
+	/* invalid files keep the current lists */
+	ioutil.WriteFile(file, []byte("allow nonsense\n"), 0600)
+	if err = f.Reload(); err == nil || !f.Allowed(net.ParseIP("192.0.2.2")) {
+		t.Errorf("Expected invalid file to be rejected.")
+	}
+
+	ioutil.WriteFile(file, []byte("allow 198.51.100.0/24\n"), 0600)
+	if err = f.Reload(); err != nil || !f.Allowed(net.ParseIP("198.51.100.1")) {
+		t.Errorf("Expected reloaded entries to be applied, got error %v.", err)
+	}
+}
@@ -12,7 +12,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,13 +25,25 @@ var (
 
 // Jantar is the top level application type
 type Jantar struct {
-	closing    bool
-	wg         sync.WaitGroup
-	listener   net.Listener
-	config     *Config
-	middleware []IMiddleware
-	tm         *TemplateManager
-	router     *router
+	closing       bool
+	initialized   bool
+	stopping      chan struct{}
+	wg            sync.WaitGroup
+	listener      net.Listener
+	config        *Config
+	middleware    []IMiddleware
+	pipeline      http.Handler
+	wsPipeline    http.Handler
+	outerPipeline http.Handler
+	pipelineMutex sync.Mutex
+	tm            *TemplateManager
+	router        *router
+	services      *services
+	i18n          *I18n
+	proxies       *trustedProxies
+	maintenance   *maintenance
+	metrics       *metrics
+	inFlight      int64
 }
 
 // TLSConfig can be given to Jantar to enable tls support
@@ -46,6 +60,28 @@ type Config struct {
 	Hostname string
 	Port     int
 	TLS      *TLSConfig
+	Upload   *UploadConfig
+	CSRF     *CSRFConfig
+	I18n     *I18nConfig
+	// RedirectHosts lists additional hosts Controller.RedirectReturnTo is allowed to redirect to
+	RedirectHosts []string
+	// MaxBodySize is the maximum size in bytes of request bodies that are not multipart uploads. Defaults to 10MB
+	MaxBodySize int64
+	// Timeout is the deadline of route handlers including their middleware. Zero disables the deadline
+	Timeout time.Duration
+	// TimeoutStatus is the status code of timed out requests, either 503 or 504. Defaults to 503
+	TimeoutStatus int
+	// TrustedProxies lists ip addresses and CIDRs of reverse proxies whose Forwarded and X-Forwarded-* headers are
+	// used to resolve the client ip, scheme and host
+	TrustedProxies []string
+	// Maintenance configures how the maintenance mode is toggled and who may bypass it
+	Maintenance *MaintenanceConfig
+	// Metrics enables the metrics endpoint
+	Metrics *MetricsConfig
+	// SecurityHeaders are sent with every response. Defaults to DefaultSecurityHeaders
+	SecurityHeaders *SecurityHeaders
+	// CSPReport enables the endpoint collecting Content-Security-Policy violation reports
+	CSPReport *CSPReportConfig
 }
 
 // New creates a new Jantar instance ready to listen on a given hostname and port.
@@ -62,8 +98,27 @@ func New(config *Config) *Jantar {
 		config:     config,
 		tm:         newTemplateManager("views"),
 		router:     newRouter(),
+		services:   newServices(),
 		middleware: nil,
 		closing:    false,
+		stopping:   make(chan struct{}),
+	}
+
+	if j.config.I18n == nil {
+		j.config.I18n = &I18nConfig{}
+	}
+	j.i18n = newI18n(j.config.I18n)
+
+	if j.config.Upload == nil {
+		j.config.Upload = defaultUploadConfig
+	}
+
+	if j.config.MaxBodySize == 0 {
+		j.config.MaxBodySize = defaultMaxBodySize
+	}
+
+	if j.config.TimeoutStatus == 0 {
+		j.config.TimeoutStatus = http.StatusServiceUnavailable
 	}
 
 	if j.config.Port < 1 {
@@ -74,8 +129,22 @@ func New(config *Config) *Jantar {
 		}
 	}
 
+	proxies, err := newTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		Log.Fatald(JLData{"error": err}, "failed to parse trusted proxies")
+	}
+	j.proxies = proxies
+
+	if j.maintenance, err = newMaintenance(config.Maintenance); err != nil {
+		Log.Fatald(JLData{"error": err}, "failed to parse maintenance config")
+	}
+
+	if j.config.SecurityHeaders == nil {
+		j.config.SecurityHeaders = DefaultSecurityHeaders()
+	}
+
 	// load default middleware
-	j.AddMiddleware(&csrf{})
+	j.AddMiddleware(&csrf{config: config.CSRF})
 
 	// load ssl certificate
 	if config.TLS != nil {
@@ -86,17 +155,46 @@ func New(config *Config) *Jantar {
 
 	setModule(ModuleTemplateManager, j.tm)
 	setModule(ModuleRouter, j.router)
+	setModule(ModuleConfig, j.config)
+	setModule(moduleServices, j.services)
+	setModule(ModuleI18n, j.i18n)
+
+	if config.Metrics != nil {
+		j.metrics = newMetrics(config.Metrics, &j.inFlight)
+		j.router.addRoute("GET", config.Metrics.Path, j.metrics.ServeHTTP)
+	}
+	setModule(moduleMetrics, j.metrics)
+
+	if config.CSPReport != nil {
+		collector := newCSPReportCollector(config.CSPReport)
+		route := j.router.addRoute("POST", config.CSPReport.Path, collector.ServeHTTP).MaxBodySize(config.CSPReport.MaxSize)
+		route.skipCSRF = true
+	}
+
+	// localized template functions
+	j.tm.AddTmplFunc("msg", func(key string, args ...interface{}) string { return key })
+	j.tm.AddHook(TmBeforeRender, j.i18n.beforeRenderHook)
+	j.tm.AddHook(TmBeforeRender, cspBeforeRenderHook)
 
 	return j
 }
 
-// AddMiddleware adds a given middleware to the current middleware list. Middlewares are executed
-// once for every request before the actual route handler is called
+// AddMiddleware adds a given middleware to the current middleware list. Middlewares wrap the route handler
+// in the order they have been added, so the first Middleware runs first and finishes last. Middlewares
+// implementing IOuterMiddleware wrap all others including the built-in ones
 func (j *Jantar) AddMiddleware(mware IMiddleware) {
-	if len(j.middleware) > 0 {
-		j.middleware[len(j.middleware)-1].setNext(&mware)
-	}
+	j.pipelineMutex.Lock()
+	defer j.pipelineMutex.Unlock()
+
 	j.middleware = append(j.middleware, mware)
+	j.pipeline = nil
+	j.wsPipeline = nil
+	j.outerPipeline = nil
+}
+
+// Use adds a net/http compatible middleware to the current middleware list
+func (j *Jantar) Use(mware MiddlewareFunc) {
+	j.AddMiddleware(&funcMiddleware{wrap: mware})
 }
 
 func (j *Jantar) initMiddleware() {
@@ -111,17 +209,85 @@ func (j *Jantar) cleanupMiddleware() {
 	}
 }
 
-func (j *Jantar) callMiddleware(respw http.ResponseWriter, req *http.Request) bool {
+// getCSRF returns the csrf Middleware or nil if the protection is disabled
+func (j *Jantar) getCSRF() *csrf {
+	var protection *csrf
 	for _, mw := range j.middleware {
-		if !mw.Call(respw, req) {
-			return false
+		if c, ok := mw.(*csrf); ok {
+			protection = c
+		}
+	}
+	return protection
+}
+
+// getOuterPipeline returns the request handling wrapped by the Middlewares implementing IOuterMiddleware
+func (j *Jantar) getOuterPipeline() http.Handler {
+	j.pipelineMutex.Lock()
+	defer j.pipelineMutex.Unlock()
+
+	if j.outerPipeline == nil {
+		var handler http.Handler = http.HandlerFunc(j.serve)
+		for i := len(j.middleware) - 1; i >= 0; i-- {
+			if mw, ok := j.middleware[i].(IOuterMiddleware); ok {
+				handler = wrapMiddleware(mw, handler)
+			}
+		}
+		j.outerPipeline = handler
+	}
+
+	return j.outerPipeline
+}
+
+// getPipeline returns the route handler wrapped by all middleware except the outer ones. The pipeline is
+// built on first use
+func (j *Jantar) getPipeline() http.Handler {
+	j.pipelineMutex.Lock()
+	defer j.pipelineMutex.Unlock()
+
+	if j.pipeline == nil {
+		var handler http.Handler = http.HandlerFunc(j.callRoute)
+		for i := len(j.middleware) - 1; i >= 0; i-- {
+			if _, ok := j.middleware[i].(IOuterMiddleware); !ok {
+				handler = wrapMiddleware(j.middleware[i], handler)
+			}
 		}
+		j.pipeline = handler
+	}
+
+	return j.pipeline
+}
 
-		if mw.doesYield() {
-			break
+// getWebSocketPipeline returns the route handler wrapped by the Middlewares that run before websocket upgrades
+func (j *Jantar) getWebSocketPipeline() http.Handler {
+	j.pipelineMutex.Lock()
+	defer j.pipelineMutex.Unlock()
+
+	if j.wsPipeline == nil {
+		var handler http.Handler = http.HandlerFunc(j.callRoute)
+		for i := len(j.middleware) - 1; i >= 0; i-- {
+			if _, ok := j.middleware[i].(IOuterMiddleware); ok {
+				continue
+			}
+			if mw, ok := j.middleware[i].(IWebSocketMiddleware); ok {
+				handler = wrapMiddleware(mw, handler)
+			}
 		}
+		j.wsPipeline = handler
+	}
+
+	return j.wsPipeline
+}
+
+// callRoute is the innermost handler of the pipeline and calls the handler of the matched route
+func (j *Jantar) callRoute(respw http.ResponseWriter, req *http.Request) {
+	if route, ok := context.Get(req, "_Route").(*route); ok && route != nil {
+		route.handler(respw, req)
+
+		// the writers of outer middlewares like compression are closed when the pipeline unwinds
+		closeEventStream(req)
+	} else {
+		ErrorHandler(http.StatusNotFound)(respw, req)
 	}
-	return true
 }
 
 // AddRoute adds a route with given method, pattern and handler to the Router
@@ -156,10 +322,7 @@ func (j *Jantar) listenAndServe(addr string, handler http.Handler) error {
 
 		// listen redirect port 80 to 443 if using the standard port
 		if j.config.Port == 443 {
-			go http.ListenAndServe(fmt.Sprintf("%s:%d", j.config.Hostname, 80), http.HandlerFunc(
-				func(respw http.ResponseWriter, req *http.Request) {
-					http.Redirect(respw, req, "https://"+j.config.Hostname+req.RequestURI, 301)
-				}))
+			go http.ListenAndServe(fmt.Sprintf("%s:%d", j.config.Hostname, 80), http.HandlerFunc(j.redirectHTTPS))
 		}
 	} else {
 		j.listener, err = net.Listen("tcp", addr)
@@ -177,37 +340,145 @@ func (j *Jantar) listenAndServe(addr string, handler http.Handler) error {
 	return nil
 }
 
+// redirectHTTPS redirects plain http requests to https. Requests a trusted proxy received over tls are served
+// directly to prevent redirect loops
+func (j *Jantar) redirectHTTPS(respw http.ResponseWriter, req *http.Request) {
+	resolved := context.Bind(req)
+	j.proxies.resolve(resolved)
+	scheme := RequestScheme(resolved)
+	context.ClearData(resolved)
+
+	if scheme == "https" {
+		j.ServeHTTP(respw, req)
+		return
+	}
+
+	http.Redirect(respw, req, "https://"+j.config.Hostname+req.RequestURI, 301)
+}
+
+// pendingRequest calls finish once the request has been served and a handler that outlived it, e.g. after a
+// timeout, has returned
+type pendingRequest struct {
+	refs   int32
+	finish func()
+}
+
+func (p *pendingRequest) hold() {
+	atomic.AddInt32(&p.refs, 1)
+}
+
+func (p *pendingRequest) release() {
+	if atomic.AddInt32(&p.refs, -1) == 0 {
+		p.finish()
+	}
+}
+
 // ServeHTTP implements the http.Handler interface
 func (j *Jantar) ServeHTTP(respw http.ResponseWriter, req *http.Request) {
 	j.wg.Add(1)
+	atomic.AddInt64(&j.inFlight, 1)
 
 	t0 := time.Now()
 
-	if method := req.FormValue("_method"); method != "" {
-		req.Method = method
+	var rw IResponseWriter
+	if j.metrics != nil {
+		rw = newResponseWriter(respw)
+		respw = rw
 	}
 
-	Log.Infof("%s %s", req.Method, req.URL.Path)
-
-	// set security header
-	respw.Header().Set("Strict-Transport-Security", "max-age=31536000;includeSubDomains")
-	respw.Header().Set("X-Frame-Options", "sameorigin")
-	respw.Header().Set("X-XSS-Protection", "1;mode=block")
-	respw.Header().Set("X-Content-Type-Options", "nosniff")
+	// middleware may replace the request without losing its context data
+	req = context.Bind(req)
+	j.proxies.resolve(req)
 
 	context.Set(req, "_RenderArgs", make(map[string]interface{}), true)
-	if j.callMiddleware(respw, req) {
-		if route := j.router.searchRoute(req); route != nil {
-			route.handler(respw, req)
-		} else {
-			ErrorHandler(http.StatusNotFound)(respw, req)
+	context.Set(req, "_Stopping", j.stopping, true)
+	path := req.URL.Path
+	// the route can only be found once the locale prefix has been stripped
+	j.i18n.resolveLocale(req)
+
+	// the method override reads urlencoded bodies, so the limit of the route has to be applied beforehand
+	limitBody(req, j.bodyLimit(req))
+	methodOverride(req)
+
+	method := req.Method
+	pending := &pendingRequest{refs: 1, finish: func() {
+		closeEventStream(req)
+		cleanupUploads(req)
+
+		if rw != nil {
+			route, _ := context.Get(req, "_Route").(*route)
+			j.metrics.observeRequest(route, method, rw.Status(), time.Since(t0))
 		}
+
+		requestLogger(req).Debugd(JLData{"method": method, "path": path, "duration": time.Since(t0)}, "request completed")
+		context.ClearData(req)
+
+		atomic.AddInt64(&j.inFlight, -1)
+		j.wg.Done()
+	}}
+	context.Set(req, "_Pending", pending, true)
+
+	defer pending.release()
+	defer j.recoverPanic(respw, req)
+
+	j.getOuterPipeline().ServeHTTP(respw, req)
+}
+
+// serve is the innermost handler of the outer pipeline. It matches the route and serves it unless the request
+// is rejected beforehand
+func (j *Jantar) serve(respw http.ResponseWriter, req *http.Request) {
+	// outer middlewares like the access log have to see the error response
+	defer j.recoverPanic(respw, req)
+
+	route := j.router.searchRoute(req)
+	context.Set(req, "_Route", route, true)
+
+	// websocket routes check the origin themselves and don't need the security header. All other responses
+	// including the maintenance page get them
+	if route == nil || !route.websocket {
+		security := j.config.SecurityHeaders
+		if route != nil && route.security != nil {
+			security = route.security
+		}
+		security.apply(respw, req)
 	}
 
-	context.ClearData(req)
-	Log.Infof("completed in %v", time.Since(t0))
+	switch {
+	case j.maintenance.serve(respw, req, j.tm):
+		// the maintenance page has been served
+	case route != nil && route.websocket:
+		// Middlewares modifying the response are skipped as the connection is taken over by the handler
+		j.getWebSocketPipeline().ServeHTTP(respw, req)
+	default:
+		upload := j.config.Upload
+		maxBody := j.config.MaxBodySize
+		timeout := j.config.Timeout
+
+		if route != nil {
+			if route.upload != nil {
+				upload = route.upload
+			}
+			if route.maxBody != 0 {
+				maxBody = route.maxBody
+			}
+			if route.timeout != 0 {
+				timeout = route.timeout
+			}
+		}
 
-	j.wg.Done()
+		if checkBodySize(respw, req, maxBody) && parseUpload(respw, req, upload, j.getCSRF()) {
+			j.serveWithTimeout(respw, req, timeout)
+		}
+	}
+}
+
+// recoverPanic responds with an internal server error if the request handling panicked
+func (j *Jantar) recoverPanic(respw http.ResponseWriter, req *http.Request) {
+	if err := recover(); err != nil {
+		j.metrics.incPanics()
+		requestLogger(req).Errord(JLData{"error": err, "stack": string(debug.Stack())}, "recovered from panic")
+		http.Error(respw, "500 internal server error", http.StatusInternalServerError)
+	}
 }
 
 // Stop closes the listener and stops the server when all pending requests have been finished
@@ -217,21 +488,48 @@ func (j *Jantar) Stop() {
 	// stop listening for new connections
 	j.listener.Close()
 
+	// close long living connections like event streams
+	close(j.stopping)
+
 	// wait until all pending requests have been finished
 	j.wg.Wait()
 
 	j.cleanupMiddleware()
 }
 
-// Run starts the http server and listens on the hostname and port given to New
-func (j *Jantar) Run() {
+// Initialize prepares all middleware and loads the templates. Run calls Initialize automatically so it only
+// has to be called when requests are served without Run, e.g. by the jantartest package
+func (j *Jantar) Initialize() error {
+	if j.initialized {
+		return nil
+	}
+
 	j.initMiddleware()
 
+	if err := j.services.check(j.router); err != nil {
+		return err
+	}
+
+	if err := j.i18n.loadCatalogs(); err != nil {
+		return err
+	}
+
 	if err := j.tm.loadTemplates(); err != nil {
-		Log.Fatal("failed to load templates")
+		return err
+	}
+
+	j.initialized = true
+	return nil
+}
+
+// Run starts the http server and listens on the hostname and port given to New
+func (j *Jantar) Run() {
+	if err := j.Initialize(); err != nil {
+		Log.Fatald(JLData{"error": err}, "failed to initialize")
 	}
 
 	go j.listenForSignals()
+	go j.listenForMaintenanceSignal()
 
 	Log.Infod(JLData{"hostname": j.config.Hostname, "port": j.config.Port, "TLS": j.config.TLS != nil}, "starting server & listening")
 
@@ -0,0 +1,283 @@
+// Package jantartest provides a test client for jantar applications.
+//
+// The Client serves requests in-process, keeps a cookie jar, submits the csrf token automatically and
+// records the rendered template and RenderArgs of every response.
+package jantartest
+
+import (
+	"bytes"
+	"context"
+	"github.com/tsurai/jantar"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const maxRedirects = 10
+
+var (
+	csrfTokenRegexp = regexp.MustCompile(`<meta name="csrf-token" content="([^"]+)"`)
+
+	// the render hook is shared by all clients of a TemplateManager
+	hookMutex    sync.Mutex
+	hookManagers = make(map[*jantar.TemplateManager]bool)
+)
+
+// Client is a test client sending requests directly to a Jantar instance
+type Client struct {
+	// FollowRedirects makes the client follow redirect responses. 307 and 308 redirects repeat the method
+	// and body of the request, all others are followed with a GET request
+	FollowRedirects bool
+	// BaseURL is used to resolve relative paths and cookies
+	BaseURL *url.URL
+	// CSRFPath is the page requested to obtain a csrf token if no page has been rendered yet. Defaults to "/"
+	CSRFPath string
+
+	t         testing.TB
+	handler   http.Handler
+	jar       *cookiejar.Jar
+	csrfToken string
+}
+
+type renderKey struct{}
+
+type render struct {
+	template string
+	args     map[string]interface{}
+}
+
+// Response is a recorded response with assertion helpers. Assertions report failures to the testing.TB
+// of the client and return the Response for chaining
+type Response struct {
+	*httptest.ResponseRecorder
+	// Template is the name of the rendered template or empty if nothing has been rendered
+	Template string
+	// RenderArgs are the arguments the template has been rendered with
+	RenderArgs map[string]interface{}
+
+	t testing.TB
+}
+
+// NewClient initializes j and returns a new Client for it
+func NewClient(t testing.TB, j *jantar.Jantar) *Client {
+	if err := j.Initialize(); err != nil {
+		t.Fatalf("failed to initialize jantar: %v", err)
+	}
+
+	jar, _ := cookiejar.New(nil)
+	c := &Client{
+		BaseURL:  &url.URL{Scheme: "http", Host: "localhost"},
+		CSRFPath: "/",
+		t:        t,
+		handler:  j,
+		jar:      jar,
+	}
+
+	tm := jantar.GetModule(jantar.ModuleTemplateManager).(*jantar.TemplateManager)
+
+	hookMutex.Lock()
+	defer hookMutex.Unlock()
+
+	if !hookManagers[tm] {
+		tm.AddHook(jantar.TmBeforeRender, recordRender)
+		hookManagers[tm] = true
+	}
+
+	return c
+}
+
+func recordRender(req *http.Request, tm *jantar.TemplateManager, tmpl *template.Template, args map[string]interface{}) {
+	if r, ok := req.Context().Value(renderKey{}).(*render); ok {
+		r.template = tmpl.Name()
+		r.args = args
+	}
+}
+
+// CSRFToken returns the csrf token of the last page rendered for this client. If no page has been rendered
+// yet, the page at CSRFPath is requested first
+func (c *Client) CSRFToken() string {
+	if c.csrfToken == "" {
+		c.Get(c.CSRFPath)
+	}
+
+	if c.csrfToken == "" {
+		c.t.Errorf("no csrf token found in the page at '%s'", c.CSRFPath)
+	}
+
+	return c.csrfToken
+}
+
+// Get sends a GET request to the given path
+func (c *Client) Get(path string) *Response {
+	return c.Do(c.NewRequest("GET", path, nil))
+}
+
+// Post sends a POST request with the given form values and the csrf token
+func (c *Client) Post(path string, form url.Values) *Response {
+	return c.Do(c.NewRequest("POST", path, form))
+}
+
+// Put sends a PUT request with the given form values and the csrf token
+func (c *Client) Put(path string, form url.Values) *Response {
+	return c.Do(c.NewRequest("PUT", path, form))
+}
+
+// Delete sends a DELETE request with the csrf token
+func (c *Client) Delete(path string) *Response {
+	return c.Do(c.NewRequest("DELETE", path, url.Values{}))
+}
+
+// NewRequest creates a request for the given method and path. Unless the method is safe the form values
+// are encoded as body together with the csrf token
+func (c *Client) NewRequest(method string, path string, form url.Values) *http.Request {
+	var req *http.Request
+	var err error
+
+	target := c.BaseURL.ResolveReference(&url.URL{Path: path})
+	if i := strings.Index(path, "?"); i != -1 {
+		target = c.BaseURL.ResolveReference(&url.URL{Path: path[:i], RawQuery: path[i+1:]})
+	}
+
+	if method == "GET" || method == "HEAD" {
+		req, err = http.NewRequest(method, target.String(), nil)
+	} else {
+		values := url.Values{}
+		for key, value := range form {
+			values[key] = value
+		}
+		values.Set("_csrf-token", c.CSRFToken())
+
+		req, err = http.NewRequest(method, target.String(), strings.NewReader(values.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+
+	if err != nil {
+		c.t.Fatalf("failed to create request: %v", err)
+	}
+
+	return req
+}
+
+// Do sends a request with the cookies of the client and follows redirects if FollowRedirects is set
+func (c *Client) Do(req *http.Request) *Response {
+	// the body is kept for redirects repeating the request
+	var body []byte
+	if req.Body != nil {
+		body, _ = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	header := req.Header.Clone()
+
+	resp := c.serve(req)
+
+	for i := 0; c.FollowRedirects && i < maxRedirects; i++ {
+		location := resp.Header().Get("Location")
+		if resp.Code < 300 || resp.Code >= 400 || location == "" {
+			break
+		}
+
+		target, err := req.URL.Parse(location)
+		if err != nil {
+			c.t.Errorf("invalid redirect location '%s': %v", location, err)
+			break
+		}
+
+		if resp.Code == http.StatusTemporaryRedirect || resp.Code == http.StatusPermanentRedirect {
+			req, err = http.NewRequest(req.Method, c.BaseURL.ResolveReference(target).String(), bytes.NewReader(body))
+			if err != nil {
+				c.t.Fatalf("failed to create request: %v", err)
+			}
+			req.Header = header.Clone()
+		} else {
+			req = c.NewRequest("GET", target.RequestURI(), nil)
+		}
+
+		resp = c.serve(req)
+	}
+
+	return resp
+}
+
+func (c *Client) serve(req *http.Request) *Response {
+	for _, cookie := range c.jar.Cookies(req.URL) {
+		req.AddCookie(cookie)
+	}
+
+	// the render hook finds the record through the request context
+	r := &render{}
+	req = req.WithContext(context.WithValue(req.Context(), renderKey{}, r))
+
+	recorder := httptest.NewRecorder()
+	c.handler.ServeHTTP(recorder, req)
+	c.jar.SetCookies(req.URL, recorder.Result().Cookies())
+
+	if match := csrfTokenRegexp.FindStringSubmatch(recorder.Body.String()); match != nil {
+		c.csrfToken = match[1]
+	}
+
+	return &Response{ResponseRecorder: recorder, Template: r.template, RenderArgs: r.args, t: c.t}
+}
+
+// AssertStatus checks the status code of the response
+func (r *Response) AssertStatus(status int) *Response {
+	r.t.Helper()
+
+	if r.Code != status {
+		r.t.Errorf("expected status %d, got %d", status, r.Code)
+	}
+	return r
+}
+
+// AssertHeader checks the value of a response header
+func (r *Response) AssertHeader(name string, value string) *Response {
+	r.t.Helper()
+
+	if got := r.Header().Get(name); got != value {
+		r.t.Errorf("expected header %s to be '%s', got '%s'", name, value, got)
+	}
+	return r
+}
+
+// AssertBodyContains checks if the response body contains a given string
+func (r *Response) AssertBodyContains(str string) *Response {
+	r.t.Helper()
+
+	if !strings.Contains(r.Body.String(), str) {
+		r.t.Errorf("expected body to contain '%s'", str)
+	}
+	return r
+}
+
+// AssertTemplate checks the name of the rendered template, e.g. "app/index.html"
+func (r *Response) AssertTemplate(name string) *Response {
+	r.t.Helper()
+
+	if r.Template != strings.ToLower(name) {
+		r.t.Errorf("expected template '%s' to be rendered, got '%s'", name, r.Template)
+	}
+	return r
+}
+
+// AssertRenderArg checks if the template has been rendered with a given argument
+func (r *Response) AssertRenderArg(key string, value interface{}) *Response {
+	r.t.Helper()
+
+	got, ok := r.RenderArgs[key]
+	if !ok {
+		r.t.Errorf("expected render argument '%s' to be set", key)
+	} else if !reflect.DeepEqual(got, value) {
+		r.t.Errorf("expected render argument '%s' to be '%v', got '%v'", key, value, got)
+	}
+	return r
+}
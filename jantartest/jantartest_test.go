@@ -0,0 +1,101 @@
+package jantartest
+
+import (
+	"github.com/tsurai/jantar"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type App struct {
+	jantar.Controller
+}
+
+func (c *App) Index() {
+	c.RenderArgs["name"] = "jantar"
+	c.Render()
+}
+
+// TestMain runs all tests in a temporary directory containing the views of App. The directory is only removed
+// at the end as the template watcher reloads the views on changes
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "jantartest")
+	if err != nil {
+		panic(err)
+	}
+
+	os.MkdirAll(filepath.Join(dir, "views", "app"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "views", "app", "index.html"), []byte("<html><head></head><body>{{.name}}</body></html>"), 0644)
+
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+
+	code := m.Run()
+
+	os.Chdir(wd)
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestClient(t *testing.T) {
+	j := jantar.New(&jantar.Config{Hostname: "localhost", Port: 3000})
+	jantar.Log.SetMinLevel(jantar.LogLevelPanic)
+
+	j.AddRoute("GET", "/", func(respw http.ResponseWriter, req *http.Request) {
+		respw.Write([]byte("hello " + req.FormValue("name")))
+	})
+	j.AddRoute("GET", "/form", (*App).Index)
+	j.AddRoute("POST", "/submit", func(respw http.ResponseWriter, req *http.Request) {
+		http.Redirect(respw, req, "/?name="+req.PostFormValue("name"), http.StatusSeeOther)
+	})
+
+	c := NewClient(t, j)
+	c.CSRFPath = "/form"
+	c.Get("/").AssertStatus(http.StatusOK).AssertBodyContains("hello")
+
+	/* csrf token is taken from a rendered page and submitted automatically */
+	c.Post("/submit", url.Values{"name": {"jantar"}}).AssertStatus(http.StatusSeeOther).AssertHeader("Location", "/?name=jantar")
+
+	c.FollowRedirects = true
+	c.Post("/submit", url.Values{"name": {"jantar"}}).AssertStatus(http.StatusOK).AssertBodyContains("hello jantar")
+
+	/* requests without token are still rejected */
+	req, _ := http.NewRequest("POST", "/submit", nil)
+	c.Do(req).AssertStatus(http.StatusBadRequest)
+}
+
+func TestClientRedirect(t *testing.T) {
+	j := jantar.New(&jantar.Config{Hostname: "localhost", Port: 3000})
+	jantar.Log.SetMinLevel(jantar.LogLevelPanic)
+
+	j.AddRoute("GET", "/", (*App).Index)
+	j.AddRoute("POST", "/temporary", func(respw http.ResponseWriter, req *http.Request) {
+		http.Redirect(respw, req, "/target", http.StatusTemporaryRedirect)
+	})
+	j.AddRoute("POST", "/permanent", func(respw http.ResponseWriter, req *http.Request) {
+		http.Redirect(respw, req, "/target", http.StatusPermanentRedirect)
+	})
+	j.AddRoute("POST", "/target", func(respw http.ResponseWriter, req *http.Request) {
+		respw.Write([]byte("posted " + req.PostFormValue("name")))
+	})
+
+	c := NewClient(t, j)
+	c.FollowRedirects = true
+
+	/* 307 and 308 repeat the method and body */
+	for _, path := range []string{"/temporary", "/permanent"} {
+		c.Post(path, url.Values{"name": {"jantar"}}).AssertStatus(http.StatusOK).AssertBodyContains("posted jantar")
+	}
+}
+
+func TestClientRender(t *testing.T) {
+	j := jantar.New(&jantar.Config{Hostname: "localhost", Port: 3000})
+	jantar.Log.SetMinLevel(jantar.LogLevelPanic)
+	j.AddRoute("GET", "/", (*App).Index)
+
+	c := NewClient(t, j)
+	c.Get("/").AssertStatus(http.StatusOK).AssertTemplate("app/index.html").AssertRenderArg("name", "jantar").AssertBodyContains("csrf-token")
+}
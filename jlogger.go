@@ -30,6 +30,7 @@ type JLogger struct {
 	log      *log.Logger
 	minLevel uint
 	ansiMode bool
+	data     JLData
 }
 
 // JLData is a type describing map that can be passed to Data<Level>f functions for debug output
@@ -80,7 +81,23 @@ func NewJLogger(out io.Writer, prefix string, minLevel uint) *JLogger {
 		ansiMode = true
 	}
 
-	return &JLogger{log.New(out, prefix, 0), minLevel, ansiMode}
+	return &JLogger{log.New(out, prefix, 0), minLevel, ansiMode, nil}
+}
+
+// WithData returns a JLogger writing to the same output that adds data to every message
+func (l *JLogger) WithData(data JLData) *JLogger {
+	return &JLogger{l.log, l.minLevel, l.ansiMode, mergeData(l.data, data)}
+}
+
+func mergeData(a JLData, b JLData) JLData {
+	merged := make(JLData, len(a)+len(b))
+	for key, val := range a {
+		merged[key] = val
+	}
+	for key, val := range b {
+		merged[key] = val
+	}
+	return merged
 }
 
 // SetMinLevel changes the loggers current minimal logging level
@@ -216,6 +233,10 @@ func (l *JLogger) printData(level uint, data JLData, format string, v ...interfa
 	if level >= l.minLevel {
 		var msg string
 
+		if len(l.data) > 0 {
+			data = mergeData(l.data, data)
+		}
+
 		if format != "" {
 			msg = fmt.Sprintf(format, v...)
 		} else {
@@ -250,6 +271,11 @@ func (l *JLogger) printData(level uint, data JLData, format string, v ...interfa
 }
 
 func (l *JLogger) print(level uint, format string, v ...interface{}) {
+	if len(l.data) > 0 {
+		l.printData(level, nil, format, v...)
+		return
+	}
+
 	if level >= l.minLevel {
 		var msg string
 
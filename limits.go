@@ -0,0 +1,241 @@
+package jantar
+
+import (
+	"bytes"
+	stdcontext "context"
+	"errors"
+	"github.com/tsurai/jantar/context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrBodyTooLarge is returned when reading a request body that exceeds the configured limit
+var ErrBodyTooLarge = errors.New("request body too large")
+
+const defaultMaxBodySize = 10 << 20
+
+// limitedBody limits the number of bytes read from a request body. The limit can be changed as long as the
+// route of the request is not known yet
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+// timeoutWriter buffers the response of a handler running with a deadline. It implements neither http.Flusher nor
+// http.Hijacker, so routes streaming their response or taking over the connection have to disable the timeout
+type timeoutWriter struct {
+	mutex    sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+// MaxBodySize sets the maximum size in bytes of request bodies of this route. Multipart uploads are limited by Upload
+func (r *route) MaxBodySize(size int64) *route {
+	r.maxBody = size
+	return r
+}
+
+// Timeout sets the deadline of this route. A negative duration disables the global timeout for this route, which
+// is required for event streams as responses of routes with a deadline are buffered. Handlers are not stopped when
+// the deadline is exceeded and should watch the context of the request. Until they return, the request is pending
+// and Stop waits for it
+func (r *route) Timeout(timeout time.Duration) *route {
+	r.timeout = timeout
+	return r
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.limit <= 0 {
+		return b.ReadCloser.Read(p)
+	}
+
+	remaining := b.limit - b.read
+	if int64(len(p)) > remaining+1 {
+		p = p[:remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > remaining {
+		b.read = b.limit
+		b.exceeded = true
+		return int(remaining), ErrBodyTooLarge
+	}
+
+	b.read += int64(n)
+	return n, err
+}
+
+// limitBody wraps the body of a request so that it can't be read beyond the limit before the route is known.
+// Multipart bodies are limited by the upload configuration instead
+func limitBody(req *http.Request, limit int64) {
+	if req.Body == nil || req.Body == http.NoBody || isMultipart(req) {
+		return
+	}
+
+	body := &limitedBody{ReadCloser: req.Body, limit: limit}
+	req.Body = body
+	context.Set(req, "_Body", body, true)
+}
+
+// bodyLimit returns the body limit of the routes a request may be served by. The method of POST requests can still
+// be overridden by the body, so the largest limit of all routes the request may be overridden to is used
+func (j *Jantar) bodyLimit(req *http.Request) int64 {
+	methods := []string{req.Method}
+	if req.Method == "POST" {
+		methods = []string{"POST", "PUT", "DELETE"}
+	}
+
+	var limit int64
+	for _, method := range methods {
+		leaf, _ := j.router.findPathLeaf(method, req.URL.Path)
+		if leaf == nil {
+			continue
+		}
+
+		routeLimit := j.config.MaxBodySize
+		if leaf.route.maxBody != 0 {
+			routeLimit = leaf.route.maxBody
+		}
+		if routeLimit <= 0 {
+			return routeLimit
+		}
+		if routeLimit > limit {
+			limit = routeLimit
+		}
+	}
+
+	if limit == 0 {
+		return j.config.MaxBodySize
+	}
+	return limit
+}
+
+// checkBodySize applies the body limit of the route and rejects requests announcing a larger body or whose body
+// has already been read beyond the limit, e.g. by the method override
+func checkBodySize(respw http.ResponseWriter, req *http.Request, limit int64) bool {
+	body, ok := context.Get(req, "_Body").(*limitedBody)
+	if !ok {
+		return true
+	}
+	body.limit = limit
+
+	if limit > 0 && (req.ContentLength > limit || body.read > limit || body.exceeded) {
+		Log.Warningd(JLData{"size": req.ContentLength, "limit": limit, "path": req.URL.Path}, "rejected request body")
+		ErrorHandler(http.StatusRequestEntityTooLarge)(respw, req)
+		return false
+	}
+
+	return true
+}
+
+// serveWithTimeout runs the pipeline with a deadline. If the deadline has been exceeded the request is only
+// finished once the handler has returned
+func (j *Jantar) serveWithTimeout(respw http.ResponseWriter, req *http.Request, timeout time.Duration) {
+	if timeout <= 0 {
+		j.getPipeline().ServeHTTP(respw, req)
+		return
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(req.Context(), timeout)
+	tw := &timeoutWriter{header: respw.Header().Clone()}
+	done := make(chan struct{})
+	var panicValue interface{}
+
+	go func() {
+		defer func() {
+			panicValue = recover()
+			close(done)
+		}()
+
+		j.getPipeline().ServeHTTP(tw, req.WithContext(ctx))
+	}()
+
+	select {
+	case <-done:
+		cancel()
+		if panicValue != nil {
+			panic(panicValue)
+		}
+
+		tw.writeTo(respw)
+	case <-ctx.Done():
+		tw.mutex.Lock()
+		tw.timedOut = true
+		tw.mutex.Unlock()
+
+		data := JLData{"method": req.Method, "path": req.URL.Path, "timeout": timeout, "error": ctx.Err()}
+		if route, ok := context.Get(req, "_Route").(*route); ok && route != nil {
+			data["route"] = route.pattern
+			if route.cName != "" {
+				data["action"] = route.cName + "#" + route.cAction
+			}
+		}
+		requestLogger(req).Warningd(data, "request timed out")
+
+		ErrorHandler(j.config.TimeoutStatus)(respw, req)
+
+		// the handler may still use the request data until it notices the canceled context
+		pending := context.Get(req, "_Pending").(*pendingRequest)
+		pending.hold()
+		go func() {
+			<-done
+			cancel()
+			if panicValue != nil {
+				getMetrics().incPanics()
+				Log.Errord(JLData{"error": panicValue}, "timed out handler panicked")
+			}
+			pending.release()
+		}()
+	}
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(data)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+
+	if !tw.timedOut && tw.status == 0 {
+		tw.status = status
+	}
+}
+
+// writeTo copies the buffered response to the client
+func (tw *timeoutWriter) writeTo(respw http.ResponseWriter) {
+	header := respw.Header()
+	for key := range header {
+		delete(header, key)
+	}
+	for key, value := range tw.header {
+		header[key] = value
+	}
+
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+
+	respw.WriteHeader(tw.status)
+	respw.Write(tw.buf.Bytes())
+}
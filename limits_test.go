@@ -0,0 +1,143 @@
+package jantar
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	var readErr error
+
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	j := setupServer(false)
+	j.AddRoute("POST", "/", func(rw http.ResponseWriter, r *http.Request) {
+		_, readErr = ioutil.ReadAll(r.Body)
+	}).MaxBodySize(8)
+
+	/* announced bodies are rejected before the handler runs */
+	rw := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("0123456789"))
+	j.ServeHTTP(rw, req)
+	assertEqual(http.StatusRequestEntityTooLarge, rw.Code)
+
+	/* bodies of unknown length fail while reading */
+	rw = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/", ioutil.NopCloser(strings.NewReader("0123456789")))
+	j.ServeHTTP(rw, req)
+	assertEqual(ErrBodyTooLarge, readErr)
+
+	rw = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/", ioutil.NopCloser(strings.NewReader("01234567")))
+	j.ServeHTTP(rw, req)
+	assertEqual(nil, readErr)
+
+	/* the method override must not read chunked form bodies beyond the limit of the route */
+	form := "_method=PUT&value=0123456789"
+	j.AddRoute("PUT", "/", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(r.FormValue("value")))
+	}).MaxBodySize(8)
+
+	for _, path := range []string{"/", "/?_method=PUT"} {
+		rw = httptest.NewRecorder()
+		req, _ = http.NewRequest("POST", path, ioutil.NopCloser(strings.NewReader(form)))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		j.ServeHTTP(rw, req)
+		assertEqual(http.StatusRequestEntityTooLarge, rw.Code)
+		assertEqual(-1, strings.Index(rw.Body.String(), "0123456789"))
+	}
+
+	j.AddRoute("DELETE", "/", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(r.FormValue("value")))
+	}).MaxBodySize(64)
+
+	rw = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/", ioutil.NopCloser(strings.NewReader("_method=DELETE&value=0123456789")))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	j.ServeHTTP(rw, req)
+	assertEqual(http.StatusOK, rw.Code)
+	assertEqual("0123456789", rw.Body.String())
+}
+
+func TestMaxBodySizeLocale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jantar-messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "app.de"), []byte("greeting = Hallo\n"), 0644)
+
+	j := New(&Config{MaxBodySize: 8, I18n: &I18nConfig{Directory: dir, URLPrefix: true}})
+	j.middleware = nil
+	Log.SetMinLevel(LogLevelPanic)
+	if err := j.i18n.loadCatalogs(); err != nil {
+		t.Fatal(err)
+	}
+
+	j.AddRoute("PUT", "/big", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(r.FormValue("value")))
+	}).MaxBodySize(64)
+
+	/* the limit of the route applies to localized paths as well */
+	for _, path := range []string{"/big", "/de/big"} {
+		rw := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, ioutil.NopCloser(strings.NewReader("_method=PUT&value=0123456789")))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		j.ServeHTTP(rw, req)
+
+		if rw.Code != http.StatusOK || rw.Body.String() != "0123456789" {
+			t.Errorf("Expected %v at %s, got %v '%s'.", http.StatusOK, path, rw.Code, rw.Body.String())
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	finished := make(chan bool, 1)
+
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	j := setupServer(false)
+	j.AddRoute("GET", "/slow", func(rw http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			finished <- true
+		case <-time.After(time.Second):
+			finished <- false
+		}
+	}).Timeout(10 * time.Millisecond)
+	j.AddRoute("GET", "/fast", helloHandler).Timeout(time.Second)
+
+	rw, req := testRequest("GET", "/slow")
+	j.ServeHTTP(rw, req)
+	assertEqual(http.StatusServiceUnavailable, rw.Code)
+
+	if !<-finished {
+		t.Errorf("Expected the handler to be canceled.")
+	}
+
+	// the timed out request is finished in the background
+	j.wg.Wait()
+
+	rw, req = testRequest("GET", "/fast")
+	j.ServeHTTP(rw, req)
+	assertEqual(http.StatusOK, rw.Code)
+	assertEqual("nosniff", rw.Header().Get("X-Content-Type-Options"))
+	if rw.Body.Len() == 0 {
+		t.Errorf("Expected buffered body to be written.")
+	}
+}
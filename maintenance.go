@@ -0,0 +1,160 @@
+package jantar
+
+import (
+	"bytes"
+	"github.com/tsurai/jantar/context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MaintenanceTemplate is the template rendered while the maintenance mode is enabled. The RenderArgs contain
+// "retryAfter" as time.Duration
+const MaintenanceTemplate = "errors/maintenance.html"
+
+// MaintenanceConfig configures the maintenance mode. It can be toggled with Jantar.SetMaintenance, a signal
+// or the presence of a file
+type MaintenanceConfig struct {
+	// File enables the maintenance mode as long as it exists
+	File string
+	// Signal toggles the maintenance mode, e.g. syscall.SIGUSR1
+	Signal os.Signal
+	// RetryAfter is sent in the Retry-After header. Defaults to 5 minutes
+	RetryAfter time.Duration
+	// AllowedIPs lists ip addresses and CIDRs that can use the application during maintenance
+	AllowedIPs []string
+	// BypassCookie is the name of a cookie that lets clients through if its value equals BypassToken
+	BypassCookie string
+	BypassToken  string
+}
+
+type maintenance struct {
+	mutex     sync.RWMutex
+	config    *MaintenanceConfig
+	enabled   bool
+	allowed   []*net.IPNet
+	fileFound bool
+	lastStat  time.Time
+}
+
+func newMaintenance(config *MaintenanceConfig) (*maintenance, error) {
+	if config == nil {
+		config = &MaintenanceConfig{}
+	}
+
+	if config.RetryAfter == 0 {
+		config.RetryAfter = 5 * time.Minute
+	}
+
+	allowed, err := parseNetworks(config.AllowedIPs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &maintenance{config: config, allowed: allowed}, nil
+}
+
+// SetMaintenance enables or disables the maintenance mode
+func (j *Jantar) SetMaintenance(enabled bool) {
+	j.maintenance.mutex.Lock()
+	j.maintenance.enabled = enabled
+	j.maintenance.mutex.Unlock()
+
+	Log.Infod(JLData{"enabled": enabled}, "maintenance mode changed")
+}
+
+// InMaintenance returns true if the maintenance mode is enabled by Jantar.SetMaintenance, signal or file
+func (j *Jantar) InMaintenance() bool {
+	return j.maintenance.isEnabled()
+}
+
+func (m *maintenance) isEnabled() bool {
+	m.mutex.RLock()
+	enabled := m.enabled
+	found := m.fileFound
+	stale := m.config.File != "" && time.Since(m.lastStat) > time.Second
+	m.mutex.RUnlock()
+
+	if enabled {
+		return true
+	}
+
+	// don't stat the file for every single request
+	if stale {
+		_, err := os.Stat(m.config.File)
+		found = err == nil
+
+		m.mutex.Lock()
+		m.fileFound = found
+		m.lastStat = time.Now()
+		m.mutex.Unlock()
+	}
+
+	return found
+}
+
+// listenForMaintenanceSignal toggles the maintenance mode whenever the configured signal is received
+func (j *Jantar) listenForMaintenanceSignal() {
+	if j.maintenance.config.Signal == nil {
+		return
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, j.maintenance.config.Signal)
+
+	for range sigChan {
+		j.maintenance.mutex.RLock()
+		enabled := j.maintenance.enabled
+		j.maintenance.mutex.RUnlock()
+
+		j.SetMaintenance(!enabled)
+	}
+}
+
+// bypass checks if a client is allowed to use the application during maintenance
+func (m *maintenance) bypass(req *http.Request) bool {
+	if containsIP(m.allowed, net.ParseIP(ClientIP(req))) {
+		return true
+	}
+
+	if m.config.BypassCookie != "" && m.config.BypassToken != "" {
+		if cookie, err := req.Cookie(m.config.BypassCookie); err == nil && secureCompare(cookie.Value, m.config.BypassToken) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serve answers the request with the maintenance page. It returns false if the request may be processed
+func (m *maintenance) serve(respw http.ResponseWriter, req *http.Request, tm *TemplateManager) bool {
+	if !m.isEnabled() || m.bypass(req) {
+		return false
+	}
+
+	header := respw.Header()
+	header.Set("Retry-After", strconv.Itoa(ceilSeconds(m.config.RetryAfter)))
+	header.Set("Cache-Control", "no-store")
+
+	args := context.RenderArgs(req)
+	args["retryAfter"] = m.config.RetryAfter
+
+	var buf bytes.Buffer
+	if tm.getTemplate(MaintenanceTemplate) != nil {
+		if err := tm.RenderTemplate(&buf, req, MaintenanceTemplate, args); err != nil {
+			Log.Warning(err.Error())
+		} else {
+			header.Set("Content-Type", "text/html; charset=utf-8")
+			respw.WriteHeader(http.StatusServiceUnavailable)
+			respw.Write(buf.Bytes())
+			return true
+		}
+	}
+
+	ErrorHandler(http.StatusServiceUnavailable)(respw, req)
+	return true
+}
@@ -0,0 +1,66 @@
+package jantar
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMaintenance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jantar-maintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	j := New(&Config{Maintenance: &MaintenanceConfig{
+		File:         filepath.Join(dir, "maintenance"),
+		RetryAfter:   time.Minute,
+		AllowedIPs:   []string{"10.0.0.0/8"},
+		BypassCookie: "bypass",
+		BypassToken:  "secret",
+	}})
+	j.middleware = nil
+	Log.SetMinLevel(LogLevelPanic)
+	j.AddRoute("GET", "/", helloHandler)
+
+	/* toggled by api */
+	j.SetMaintenance(true)
+
+	rw, req := testRequest("GET", "/")
+	j.ServeHTTP(rw, req)
+	assertEqual(http.StatusServiceUnavailable, rw.Code)
+	assertEqual("60", rw.Header().Get("Retry-After"))
+	assertEqual("nosniff", rw.Header().Get("X-Content-Type-Options"))
+	assertEqual("sameorigin", rw.Header().Get("X-Frame-Options"))
+
+	/* allowed ips and the bypass cookie are let through */
+	rw, req = testRequest("GET", "/")
+	req.RemoteAddr = "10.0.0.1:1234"
+	j.ServeHTTP(rw, req)
+	assertEqual(http.StatusOK, rw.Code)
+
+	for value, status := range map[string]int{"secret": http.StatusOK, "wrong": http.StatusServiceUnavailable} {
+		rw, req = testRequest("GET", "/")
+		req.AddCookie(&http.Cookie{Name: "bypass", Value: value})
+		j.ServeHTTP(rw, req)
+		assertEqual(status, rw.Code)
+	}
+
+	/* toggled by file */
+	j.SetMaintenance(false)
+	assertEqual(false, j.InMaintenance())
+
+	ioutil.WriteFile(filepath.Join(dir, "maintenance"), nil, 0600)
+	j.maintenance.lastStat = time.Time{}
+	assertEqual(true, j.InMaintenance())
+}
@@ -0,0 +1,230 @@
+package jantar
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsConfig enables the metrics endpoint. Protect the endpoint e.g. with the IPFilter or Auth middleware
+type MetricsConfig struct {
+	// Path of the endpoint serving the metrics in the Prometheus text format. Defaults to "/metrics"
+	Path string
+	// Buckets are the upper bounds in seconds of the latency histograms
+	Buckets []float64
+}
+
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics collects request, template, csrf and panic statistics
+type metrics struct {
+	mutex          sync.Mutex
+	config         *MetricsConfig
+	inFlight       *int64
+	requests       map[requestLabels]uint64
+	durations      map[requestLabels]*histogram
+	renders        map[string]*histogram
+	csrfRejections uint64
+	panics         uint64
+}
+
+type requestLabels struct {
+	route  string
+	method string
+	status string
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newMetrics(config *MetricsConfig, inFlight *int64) *metrics {
+	if config.Path == "" {
+		config.Path = "/metrics"
+	}
+
+	if config.Buckets == nil {
+		config.Buckets = defaultBuckets
+	}
+	sort.Float64s(config.Buckets)
+
+	return &metrics{
+		config:    config,
+		inFlight:  inFlight,
+		requests:  make(map[requestLabels]uint64),
+		durations: make(map[requestLabels]*histogram),
+		renders:   make(map[string]*histogram),
+	}
+}
+
+// getMetrics returns the metrics of the current Jantar instance or nil if they are disabled
+func getMetrics() *metrics {
+	m, _ := GetModule(moduleMetrics).(*metrics)
+	return m
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (m *metrics) newHistogram() *histogram {
+	return &histogram{buckets: m.config.Buckets, counts: make([]uint64, len(m.config.Buckets))}
+}
+
+// observeRequest records a finished request. Requests without a route and with non-standard methods share a
+// single label to limit the number of series
+func (m *metrics) observeRequest(r *route, method string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	name := "unmatched"
+	if r != nil {
+		name = r.label()
+	}
+
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+	default:
+		method = "OTHER"
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.requests[requestLabels{name, method, strconv.Itoa(status)}]++
+
+	key := requestLabels{route: name, method: method}
+	if m.durations[key] == nil {
+		m.durations[key] = m.newHistogram()
+	}
+	m.durations[key].observe(duration.Seconds())
+}
+
+func (m *metrics) observeRender(name string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.renders[name] == nil {
+		m.renders[name] = m.newHistogram()
+	}
+	m.renders[name].observe(duration.Seconds())
+}
+
+func (m *metrics) incCSRFRejections() {
+	if m != nil {
+		atomic.AddUint64(&m.csrfRejections, 1)
+	}
+}
+
+func (m *metrics) incPanics() {
+	if m != nil {
+		atomic.AddUint64(&m.panics, 1)
+	}
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format
+func (m *metrics) ServeHTTP(respw http.ResponseWriter, req *http.Request) {
+	var buf bytes.Buffer
+
+	m.mutex.Lock()
+
+	writeMetricHeader(&buf, "jantar_http_requests_total", "counter", "Total number of HTTP requests.")
+	for _, labels := range sortedRequestLabels(m.requests) {
+		fmt.Fprintf(&buf, "jantar_http_requests_total{route=\"%s\",method=\"%s\",status=\"%s\"} %d\n",
+			escapeLabel(labels.route), escapeLabel(labels.method), labels.status, m.requests[labels])
+	}
+
+	writeMetricHeader(&buf, "jantar_http_request_duration_seconds", "histogram", "HTTP request latencies in seconds.")
+	for _, labels := range sortedRequestLabels(m.durations) {
+		writeHistogram(&buf, "jantar_http_request_duration_seconds",
+			fmt.Sprintf("route=\"%s\",method=\"%s\"", escapeLabel(labels.route), escapeLabel(labels.method)), m.durations[labels])
+	}
+
+	writeMetricHeader(&buf, "jantar_template_render_duration_seconds", "histogram", "Template render durations in seconds.")
+	var templates []string
+	for name := range m.renders {
+		templates = append(templates, name)
+	}
+	sort.Strings(templates)
+	for _, name := range templates {
+		writeHistogram(&buf, "jantar_template_render_duration_seconds", fmt.Sprintf("template=\"%s\"", escapeLabel(name)), m.renders[name])
+	}
+
+	m.mutex.Unlock()
+
+	writeMetricHeader(&buf, "jantar_http_requests_in_flight", "gauge", "Number of HTTP requests currently served.")
+	fmt.Fprintf(&buf, "jantar_http_requests_in_flight %d\n", atomic.LoadInt64(m.inFlight))
+
+	writeMetricHeader(&buf, "jantar_csrf_rejections_total", "counter", "Total number of requests rejected by the csrf protection.")
+	fmt.Fprintf(&buf, "jantar_csrf_rejections_total %d\n", atomic.LoadUint64(&m.csrfRejections))
+
+	writeMetricHeader(&buf, "jantar_panics_total", "counter", "Total number of recovered panics.")
+	fmt.Fprintf(&buf, "jantar_panics_total %d\n", atomic.LoadUint64(&m.panics))
+
+	respw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	respw.Write(buf.Bytes())
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name string, kind string, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeHistogram(buf *bytes.Buffer, name string, labels string, h *histogram) {
+	for i, bound := range h.buckets {
+		fmt.Fprintf(buf, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(buf, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(buf, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+func sortedRequestLabels(data interface{}) []requestLabels {
+	var keys []requestLabels
+
+	switch m := data.(type) {
+	case map[requestLabels]uint64:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case map[requestLabels]*histogram:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].route != keys[b].route {
+			return keys[a].route < keys[b].route
+		} else if keys[a].method != keys[b].method {
+			return keys[a].method < keys[b].method
+		}
+		return keys[a].status < keys[b].status
+	})
+
+	return keys
+}
+
+// escapeLabel escapes label values as required by the text exposition format
+func escapeLabel(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value)
+}
@@ -0,0 +1,50 @@
+package jantar
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	assertContains := func(body string, line string) {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected %v, got %v.", line, body)
+		}
+	}
+
+	j := New(&Config{Metrics: &MetricsConfig{Buckets: []float64{0.5, 1}}})
+	j.middleware = nil
+	Log.SetMinLevel(LogLevelPanic)
+	j.AddRoute("GET", "/", helloHandler).Name("index")
+	j.AddRoute("GET", "/panic", func(respw http.ResponseWriter, req *http.Request) {
+		panic("boom")
+	})
+
+	for _, path := range []string{"/", "/", "/panic", "/missing"} {
+		rw, req := testRequest("GET", path)
+		j.ServeHTTP(rw, req)
+	}
+
+	/* arbitrary methods must not create new series */
+	for _, method := range []string{"FOO", "BAR"} {
+		rw, req := testRequest(method, "/missing")
+		j.ServeHTTP(rw, req)
+	}
+
+	rw, req := testRequest("GET", "/metrics")
+	j.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Errorf("Expected %v, got %v.", http.StatusOK, rw.Code)
+	}
+
+	body := rw.Body.String()
+	assertContains(body, `jantar_http_requests_total{route="index",method="GET",status="200"} 2`)
+	assertContains(body, `jantar_http_requests_total{route="/panic",method="GET",status="500"} 1`)
+	assertContains(body, `jantar_http_requests_total{route="unmatched",method="GET",status="404"} 1`)
+	assertContains(body, `jantar_http_requests_total{route="unmatched",method="OTHER",status="404"} 2`)
+	assertContains(body, `jantar_http_request_duration_seconds_bucket{route="index",method="GET",le="+Inf"} 2`)
+	assertContains(body, `jantar_http_request_duration_seconds_count{route="index",method="GET"} 2`)
+	assertContains(body, `jantar_http_requests_in_flight 1`)
+	assertContains(body, `jantar_panics_total 1`)
+}
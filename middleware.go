@@ -1,15 +1,22 @@
 package jantar
 
 import (
+	"github.com/tsurai/jantar/context"
 	"net/http"
-	"reflect"
 )
 
 // Middleware implements core functionalities of the IMiddlware interface. Developer who want to write a Middleware
-// should add Middleware as an anonymous field and implement Call().
+// should add Middleware as an anonymous field and implement either Call() or Wrap().
 type Middleware struct {
-	next  *IMiddleware
-	yield bool
+	// the address of a Middleware identifies it in the request context. Pointers to distinct zero-size
+	// values may be equal, so the struct must not be empty
+	_ byte
+}
+
+// nextKey stores the next http.Handler of a Middleware in the request context. A Middleware can be part of
+// multiple pipelines, e.g. the one of websocket routes, so the handler depends on the request
+type nextKey struct {
+	m *Middleware
 }
 
 // IMiddleware is an interface that describes a Middleware
@@ -18,23 +25,85 @@ type IMiddleware interface {
 	Cleanup()
 	Call(rw http.ResponseWriter, r *http.Request) bool
 	Yield(rw http.ResponseWriter, r *http.Request)
-	setNext(mw *IMiddleware)
-	doesYield() bool
+	setNext(r *http.Request, next http.Handler)
+	hasYielded(r *http.Request) bool
+}
+
+// IHandlerMiddleware is a Middleware that wraps the next http.Handler of the pipeline instead of implementing
+// Call. Code before calling next runs before the route handler and code after it runs afterwards
+type IHandlerMiddleware interface {
+	IMiddleware
+	Wrap(next http.Handler) http.Handler
+}
+
+// IWebSocketMiddleware is a Middleware that also runs before websocket upgrades, e.g. to control the access to
+// websocket routes. Middlewares modifying the response like compression or caching must not implement it
+type IWebSocketMiddleware interface {
+	IMiddleware
+	WebSocket()
 }
 
-func (m *Middleware) doesYield() bool {
-	return m.yield
+// IOuterMiddleware is a Middleware that wraps the whole request handling instead of only the route handler.
+// It runs before the route is matched and also sees the responses of jantar itself like csrf rejections,
+// the maintenance page, rejected bodies or timeouts. Websocket upgrades are wrapped as well
+type IOuterMiddleware interface {
+	IMiddleware
+	Outer()
 }
 
-func (m *Middleware) setNext(mw *IMiddleware) {
-	m.next = mw
+// MiddlewareFunc is a net/http compatible middleware that can be added with Jantar.Use
+type MiddlewareFunc func(next http.Handler) http.Handler
+
+// funcMiddleware adapts a MiddlewareFunc to the IHandlerMiddleware interface
+type funcMiddleware struct {
+	Middleware
+	wrap MiddlewareFunc
+}
+
+// Initialize is called once before the server starts
+func (m *Middleware) Initialize() {}
+
+// Cleanup is called once after the server has been stopped
+func (m *Middleware) Cleanup() {}
+
+// Call executes the Middleware. Returning false stops the request from reaching the route handler
+func (m *Middleware) Call(rw http.ResponseWriter, r *http.Request) bool {
+	return true
 }
 
-// Yield suspends the current Middlware until all other Middlewares have been executed.
-// This way a Middleware can execute code after all other Middlewares are done
+func (m *Middleware) setNext(r *http.Request, next http.Handler) {
+	context.Set(r, nextKey{m}, next, false)
+}
+
+func (m *Middleware) hasYielded(r *http.Request) bool {
+	_, ok := context.GetOk(r, m)
+	return ok
+}
+
+// Yield executes all following Middlewares and the route handler before returning.
+// This way a Middleware can execute code after the route handler is done
 func (m *Middleware) Yield(rw http.ResponseWriter, r *http.Request) {
-	m.yield = true
-	if m.next != nil {
-		reflect.ValueOf(m.next).Elem().Interface().(IMiddleware).Call(rw, r)
+	if next, ok := context.Get(r, nextKey{m}).(http.Handler); ok && !m.hasYielded(r) {
+		context.Set(r, m, true, true)
+		next.ServeHTTP(rw, r)
+	}
+}
+
+func (f *funcMiddleware) Wrap(next http.Handler) http.Handler {
+	return f.wrap(next)
+}
+
+// wrapMiddleware wraps next with a given Middleware. Middlewares implementing only Call are adapted
+// so that next is called once, either by Yield or after Call returned true
+func wrapMiddleware(mw IMiddleware, next http.Handler) http.Handler {
+	if hmw, ok := mw.(IHandlerMiddleware); ok {
+		return hmw.Wrap(next)
 	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mw.setNext(r, next)
+		if mw.Call(rw, r) && !mw.hasYielded(r) {
+			next.ServeHTTP(rw, r)
+		}
+	})
 }
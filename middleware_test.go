@@ -0,0 +1,58 @@
+package jantar
+
+import (
+	stdcontext "context"
+	"github.com/tsurai/jantar/context"
+	"net/http"
+	"testing"
+)
+
+type yieldMiddleware struct {
+	Middleware
+	trace *[]string
+}
+
+func (m *yieldMiddleware) Call(rw http.ResponseWriter, r *http.Request) bool {
+	*m.trace = append(*m.trace, "legacy before")
+	m.Yield(rw, r)
+	*m.trace = append(*m.trace, "legacy after")
+	return true
+}
+
+type ctxKey struct{}
+
+func TestMiddlewarePipeline(t *testing.T) {
+	var trace []string
+
+	j := setupServer(false)
+	j.AddMiddleware(&yieldMiddleware{trace: &trace})
+	j.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			trace = append(trace, "func before")
+			next.ServeHTTP(rw, r.WithContext(stdcontext.WithValue(r.Context(), ctxKey{}, "value")))
+			trace = append(trace, "func after")
+		})
+	})
+	j.AddRoute("GET", "/:id", func(rw http.ResponseWriter, r *http.Request) {
+		trace = append(trace, "handler "+r.Context().Value(ctxKey{}).(string)+" "+context.UrlParam(r)["id"])
+	})
+
+	expected := []string{"legacy before", "func before", "handler value 42", "func after", "legacy after"}
+
+	for i := 0; i < 2; i++ {
+		trace = nil
+		rw, req := testRequest("GET", "/42")
+		j.ServeHTTP(rw, req)
+
+		if len(trace) != len(expected) {
+			t.Fatalf("Expected %v, got %v.", expected, trace)
+		}
+
+		for i := range expected {
+			if trace[i] != expected[i] {
+				t.Errorf("Expected %v, got %v.", expected, trace)
+				break
+			}
+		}
+	}
+}
@@ -5,6 +5,10 @@ const (
 	moduleFirst           = iota
 	ModuleTemplateManager = iota
 	ModuleRouter          = iota
+	ModuleConfig          = iota
+	moduleServices        = iota
+	ModuleI18n            = iota
+	moduleMetrics         = iota
 	moduleLast            = iota
 )
 
@@ -0,0 +1,219 @@
+package jantar
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/tsurai/jantar/context"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PaginationTemplate is the name of the template used by the paginate template function. Add a template with
+// this name to the views directory to override the default markup. It is rendered with the *Paginator as data
+const PaginationTemplate = "partials/pagination.html"
+
+var defaultPaginationTemplate = template.Must(template.New(PaginationTemplate).Parse(`{{if gt .Pages 1}}<ul class="pagination">
+{{- if .HasPrev}}<li><a href="{{.URL 1}}">&laquo;First</a></li><li><a href="{{.URL .PrevPage}}" rel="prev">&laquo;</a></li>{{end}}
+{{- range .Links}}{{if .Gap}}<li><span>...</span></li>{{else if .Current}}<li class="active"><a href="{{.URL}}">{{.Number}}</a></li>{{else}}<li><a href="{{.URL}}">{{.Number}}</a></li>{{end}}{{end}}
+{{- if .HasNext}}<li><a href="{{.URL .NextPage}}" rel="next">&raquo;</a></li><li><a href="{{.URL .Pages}}">Last&raquo;</a></li>{{end -}}
+</ul>{{end}}`))
+
+// Paginator splits a number of items into pages. The current page is read from the url parameter "page" or
+// the query parameter of the same name. Page urls are built with the reverse router if a route has been set
+// and by changing the query of the current url otherwise
+type Paginator struct {
+	Page    int
+	PerPage int
+	Total   int
+	Pages   int
+	// Window is the number of pages shown before and after the current one. Defaults to 2
+	Window int
+
+	param string
+	base  *url.URL
+	route string
+	args  []interface{}
+}
+
+// PageLink describes a single entry of Paginator.Links. Gap entries stand for omitted pages
+type PageLink struct {
+	Number  int
+	URL     string
+	Current bool
+	Gap     bool
+}
+
+// NewPaginator creates a Paginator for total items with perPage items per page and reads the current page from req
+func NewPaginator(req *http.Request, total int, perPage int) *Paginator {
+	if perPage < 1 {
+		perPage = 1
+	}
+
+	p := &Paginator{PerPage: perPage, Total: total, Window: 2, param: "page", base: req.URL}
+
+	p.Pages = (total + perPage - 1) / perPage
+	if p.Pages < 1 {
+		p.Pages = 1
+	}
+
+	page, ok := context.UrlParam(req)[p.param]
+	if !ok {
+		page = req.URL.Query().Get(p.param)
+	}
+
+	p.Page, _ = strconv.Atoi(page)
+	if p.Page < 1 {
+		p.Page = 1
+	} else if p.Page > p.Pages {
+		p.Page = p.Pages
+	}
+
+	return p
+}
+
+// Route makes the Paginator build page urls with the reverse router. The page number is appended to args
+func (p *Paginator) Route(name string, args ...interface{}) *Paginator {
+	p.route = name
+	p.args = args
+	return p
+}
+
+// Offset returns the index of the first item of the current page
+func (p *Paginator) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// HasPrev returns true if the current page is not the first one
+func (p *Paginator) HasPrev() bool {
+	return p.Page > 1
+}
+
+// HasNext returns true if the current page is not the last one
+func (p *Paginator) HasNext() bool {
+	return p.Page < p.Pages
+}
+
+// PrevPage returns the number of the previous page
+func (p *Paginator) PrevPage() int {
+	return p.Page - 1
+}
+
+// NextPage returns the number of the next page
+func (p *Paginator) NextPage() int {
+	return p.Page + 1
+}
+
+// URL returns the url of a given page
+func (p *Paginator) URL(page int) string {
+	if p.route != "" {
+		router := GetModule(ModuleRouter).(*router)
+
+		args := append(append([]interface{}{}, p.args...), page)
+		url, err := router.getReverseURL(p.route, args)
+		if err != nil {
+			Log.Warningd(JLData{"name": p.route}, "failed to build page url: unknown route name")
+		}
+		return url
+	}
+
+	u := *p.base
+	query := u.Query()
+	query.Set(p.param, strconv.Itoa(page))
+	u.RawQuery = query.Encode()
+	u.Scheme = ""
+	u.Host = ""
+
+	return u.String()
+}
+
+// Links returns the pages surrounding the current one within the window
+func (p *Paginator) Links() []PageLink {
+	var links []PageLink
+
+	first := p.Page - p.Window
+	if first < 1 {
+		first = 1
+	}
+
+	last := p.Page + p.Window
+	if last > p.Pages {
+		last = p.Pages
+	}
+
+	if first > 1 {
+		links = append(links, PageLink{Gap: true})
+	}
+
+	for i := first; i <= last; i++ {
+		links = append(links, PageLink{Number: i, URL: p.URL(i), Current: i == p.Page})
+	}
+
+	if last < p.Pages {
+		links = append(links, PageLink{Gap: true})
+	}
+
+	return links
+}
+
+// LinkHeader returns the value of a Link header pointing to the previous and next page
+func (p *Paginator) LinkHeader() string {
+	var links []string
+
+	if p.HasPrev() {
+		links = append(links, fmt.Sprintf("<%s>; rel=\"prev\"", p.URL(p.PrevPage())))
+	}
+
+	if p.HasNext() {
+		links = append(links, fmt.Sprintf("<%s>; rel=\"next\"", p.URL(p.NextPage())))
+	}
+
+	return strings.Join(links, ", ")
+}
+
+// Paginate creates a Paginator for the current request, sets the Link header and adds it to the RenderArgs
+// as "paginator"
+func (c *Controller) Paginate(total int, perPage int) *Paginator {
+	return c.paginate(NewPaginator(c.Req, total, perPage))
+}
+
+// PaginateRoute is equivalent to Paginate but builds page urls with the reverse router
+func (c *Controller) PaginateRoute(total int, perPage int, name string, args ...interface{}) *Paginator {
+	return c.paginate(NewPaginator(c.Req, total, perPage).Route(name, args...))
+}
+
+func (c *Controller) paginate(p *Paginator) *Paginator {
+	if header := p.LinkHeader(); header != "" {
+		c.Respw.Header().Add("Link", header)
+	}
+
+	c.RenderArgs["paginator"] = p
+	return p
+}
+
+// renderPagination renders the pagination template of the template set that is being rendered for a given
+// Paginator. The set is the private copy of the render whose functions are bound to the current request
+func renderPagination(templates *template.Template, p *Paginator) (template.HTML, error) {
+	var buf bytes.Buffer
+
+	if p == nil {
+		return "", nil
+	}
+
+	var tmpl *template.Template
+	if templates != nil {
+		tmpl = templates.Lookup(PaginationTemplate)
+	}
+
+	if tmpl == nil {
+		tmpl = defaultPaginationTemplate
+	}
+
+	if err := tmpl.Execute(&buf, p); err != nil {
+		return "", err
+	}
+
+	return template.HTML(buf.String()), nil
+}
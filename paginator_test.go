@@ -0,0 +1,109 @@
+package jantar
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPaginator(t *testing.T) {
+	assertEqual := func(val interface{}, exp interface{}) {
+		if val != exp {
+			t.Errorf("Expected %v, got %v.", exp, val)
+		}
+	}
+
+	j := setupServer(false)
+	j.AddRoute("GET", "/posts/page/:page", helloHandler).Name("posts")
+
+	req, _ := http.NewRequest("GET", "/posts?sort=date&page=3", nil)
+	p := NewPaginator(req, 95, 10)
+
+	assertEqual(p.Pages, 10)
+	assertEqual(p.Page, 3)
+	assertEqual(p.Offset(), 20)
+	assertEqual(p.URL(4), "/posts?page=4&sort=date")
+	assertEqual(p.LinkHeader(), "</posts?page=2&sort=date>; rel=\"prev\", </posts?page=4&sort=date>; rel=\"next\"")
+	assertEqual(len(p.Links()), 6)
+
+	p.Route("posts")
+	assertEqual(p.URL(4), "/posts/page/4")
+
+	html, err := renderPagination(nil, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(html), "<li class=\"active\"><a href=\"/posts/page/3\">3</a></li>") {
+		t.Errorf("Expected active page link, got %s.", html)
+	}
+
+	/* out of range pages are clamped */
+	req, _ = http.NewRequest("GET", "/posts?page=99", nil)
+	assertEqual(NewPaginator(req, 95, 10).Page, 10)
+}
+
+func TestPaginationLocale(t *testing.T) {
+	var wg sync.WaitGroup
+
+	dir, err := ioutil.TempDir("", "jantar-messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "app.de"), []byte("next = Weiter\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app.en"), []byte("next = Next\n"), 0644)
+
+	j := New(&Config{I18n: &I18nConfig{Directory: dir}})
+	j.middleware = nil
+	Log.SetMinLevel(LogLevelPanic)
+	if err := j.i18n.loadCatalogs(); err != nil {
+		t.Fatal(err)
+	}
+
+	templates := template.Must(template.New("index.html").Funcs(j.tm.tmplFuncs).Parse(`{{msg "next"}}|{{paginate .paginator}}`))
+	template.Must(templates.New(PaginationTemplate).Parse(`{{msg "next"}}`))
+	j.tm.setTemplates(templates)
+
+	j.AddRoute("GET", "/", func(rw http.ResponseWriter, r *http.Request) {
+		p := NewPaginator(r, 95, 10)
+		if err := j.tm.RenderTemplate(rw, r, "index.html", map[string]interface{}{"paginator": p}); err != nil {
+			t.Error(err)
+		}
+	})
+
+	render := func(locale string, expected string) {
+		rw, req := testRequest("GET", "/")
+		req.AddCookie(&http.Cookie{Name: "JANTAR_LANG", Value: locale})
+		j.ServeHTTP(rw, req)
+
+		if rw.Body.String() != expected {
+			t.Errorf("Expected %v, got %v.", expected, rw.Body.String())
+		}
+	}
+
+	/* the pagination template is rendered in the locale of the page */
+	render("de", "Weiter|Weiter")
+	render("en", "Next|Next")
+	render("de", "Weiter|Weiter")
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				render("de", "Weiter|Weiter")
+			} else {
+				render("en", "Next|Next")
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
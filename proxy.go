@@ -0,0 +1,209 @@
+package jantar
+
+import (
+	"github.com/tsurai/jantar/context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies resolves the client ip, scheme and host of requests forwarded by trusted reverse proxies
+type trustedProxies struct {
+	networks []*net.IPNet
+}
+
+// forwardedHop is a single element of the Forwarded header or of the X-Forwarded-* headers
+type forwardedHop struct {
+	client string
+	proto  string
+	host   string
+}
+
+// newTrustedProxies parses a list of ip addresses and CIDRs like "10.0.0.0/8" or "::1"
+func newTrustedProxies(proxies []string) (*trustedProxies, error) {
+	networks, err := parseNetworks(proxies)
+	if err != nil {
+		return nil, err
+	}
+	return &trustedProxies{networks: networks}, nil
+}
+
+// parseNetworks parses a list of ip addresses and CIDRs. Single addresses are treated as /32 or /128 networks
+func parseNetworks(list []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// containsIP checks if ip is part of one of the networks
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *trustedProxies) isTrusted(ip net.IP) bool {
+	return containsIP(t.networks, ip)
+}
+
+// resolve stores the client ip, scheme and host of a request. Forwarding headers are only used if the peer is a
+// trusted proxy. The client is the last hop that is not a trusted proxy itself
+func (t *trustedProxies) resolve(req *http.Request) {
+	client := remoteHost(req)
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	host := req.Host
+
+	if t != nil && t.isTrusted(net.ParseIP(client)) {
+		hops := parseForwarded(req.Header)
+
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(hops[i].client)
+			if ip == nil {
+				break
+			}
+
+			client = ip.String()
+			if !t.isTrusted(ip) {
+				break
+			}
+		}
+
+		// the proto and host were set by the proxy closest to us
+		if len(hops) > 0 {
+			if proto := strings.ToLower(hops[len(hops)-1].proto); proto == "http" || proto == "https" {
+				scheme = proto
+			}
+			if h := hops[len(hops)-1].host; isValidHost(h) {
+				host = h
+			}
+		}
+	}
+
+	context.Set(req, "_ClientIP", client, true)
+	context.Set(req, "_Scheme", scheme, true)
+	context.Set(req, "_Host", host, true)
+}
+
+// parseForwarded reads the hops of the Forwarded header and falls back to the X-Forwarded-* headers
+func parseForwarded(header http.Header) []forwardedHop {
+	var hops []forwardedHop
+
+	if values := header["Forwarded"]; len(values) > 0 {
+		for _, element := range strings.Split(strings.Join(values, ","), ",") {
+			var hop forwardedHop
+
+			for _, pair := range strings.Split(element, ";") {
+				offset := strings.Index(pair, "=")
+				if offset == -1 {
+					continue
+				}
+
+				value := strings.Trim(strings.TrimSpace(pair[offset+1:]), "\"")
+				switch strings.ToLower(strings.TrimSpace(pair[:offset])) {
+				case "for":
+					hop.client = stripPort(value)
+				case "proto":
+					hop.proto = value
+				case "host":
+					hop.host = value
+				}
+			}
+			hops = append(hops, hop)
+		}
+
+		return hops
+	}
+
+	for _, value := range strings.Split(strings.Join(header["X-Forwarded-For"], ","), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			hops = append(hops, forwardedHop{client: stripPort(value)})
+		}
+	}
+
+	if len(hops) > 0 {
+		protos := strings.Split(header.Get("X-Forwarded-Proto"), ",")
+		hops[len(hops)-1].proto = strings.TrimSpace(protos[len(protos)-1])
+		hops[len(hops)-1].host = strings.TrimSpace(header.Get("X-Forwarded-Host"))
+	}
+
+	return hops
+}
+
+// stripPort removes the port and brackets from addresses like "[::1]:80" or "192.0.2.1:80"
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
+
+func isValidHost(host string) bool {
+	return host != "" && !strings.ContainsAny(host, "/\\@ \t\r\n\"")
+}
+
+// remoteHost returns the ip address of the peer without the port
+func remoteHost(req *http.Request) string {
+	return stripPort(req.RemoteAddr)
+}
+
+// ClientIP returns the ip address of the client. Behind trusted proxies the address is read from the
+// Forwarded or X-Forwarded-For header
+func ClientIP(req *http.Request) string {
+	if ip, ok := context.GetOk(req, "_ClientIP"); ok {
+		return ip.(string)
+	}
+	return remoteHost(req)
+}
+
+// RequestScheme returns "https" if the client connected with tls, either directly or to a trusted proxy
+func RequestScheme(req *http.Request) string {
+	if scheme, ok := context.GetOk(req, "_Scheme"); ok {
+		return scheme.(string)
+	}
+
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// RequestHost returns the host requested by the client. Behind trusted proxies the host is read from the
+// Forwarded or X-Forwarded-Host header
+func RequestHost(req *http.Request) string {
+	if host, ok := context.GetOk(req, "_Host"); ok {
+		return host.(string)
+	}
+	return req.Host
+}
+
+// ClientIP returns the ip address of the client of the current request
+func (c *Controller) ClientIP() string {
+	return ClientIP(c.Req)
+}
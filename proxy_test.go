@@ -0,0 +1,45 @@
+package jantar
+
+import (
+	"github.com/tsurai/jantar/context"
+	"net/http"
+	"testing"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	proxies, err := newTrustedProxies([]string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		remote string
+		header http.Header
+		client string
+		scheme string
+		host   string
+	}{
+		/* untrusted peers can't spoof their address */
+		{"192.0.2.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}, "X-Forwarded-Proto": {"https"}}, "192.0.2.1", "http", "example.com"},
+		/* the last untrusted hop is the client */
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1, 192.0.2.1", "10.0.0.2"}, "X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"app.example.com"}}, "192.0.2.1", "https", "app.example.com"},
+		{"[::1]:1234", http.Header{"Forwarded": {`for=192.0.2.1;proto=https;host=app.example.com, for="[2001:db8::1]:80"`}}, "2001:db8::1", "http", "example.com"},
+		{"[::1]:1234", http.Header{"Forwarded": {`for=192.0.2.1, for=10.0.0.2;proto=https`}}, "192.0.2.1", "https", "example.com"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"unknown, 10.0.0.2"}}, "10.0.0.2", "http", "example.com"},
+	} {
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		req.RemoteAddr = test.remote
+		req.Header = test.header
+		proxies.resolve(req)
+
+		if ClientIP(req) != test.client || RequestScheme(req) != test.scheme || RequestHost(req) != test.host {
+			t.Errorf("Expected %s %s %s, got %s %s %s.", test.client, test.scheme, test.host, ClientIP(req), RequestScheme(req), RequestHost(req))
+		}
+
+		context.ClearData(req)
+	}
+
+	if _, err = newTrustedProxies([]string{"invalid"}); err == nil {
+		t.Errorf("Expected invalid proxy to fail.")
+	}
+}
@@ -0,0 +1,262 @@
+package jantar
+
+import (
+	"github.com/tsurai/jantar/context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defines the algorithms supported by the RateLimiter
+const (
+	// RateLimitTokenBucket allows bursts of up to Limit requests and refills Limit tokens evenly over Window
+	RateLimitTokenBucket = iota
+	// RateLimitSlidingWindow allows Limit requests within any period of Window length
+	RateLimitSlidingWindow = iota
+)
+
+// RateLimit describes how many requests a client is allowed to make within a window
+type RateLimit struct {
+	Limit     int
+	Window    time.Duration
+	Algorithm int
+}
+
+// RateLimitResult is the outcome of counting a single request
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the full limit is available again
+	Reset time.Duration
+	// RetryAfter is the time until the next request will be allowed. Only set if the request has been rejected
+	RetryAfter time.Duration
+}
+
+// IRateLimitStore is an interface that describes a storage for rate limit counters. Implementations have to be
+// safe for concurrent use
+type IRateLimitStore interface {
+	// Take counts a request for key and reports whether it is allowed under the given limit
+	Take(key string, limit *RateLimit, now time.Time) (RateLimitResult, error)
+}
+
+// RateLimitConfig configures the RateLimiter middleware
+type RateLimitConfig struct {
+	// Limit applies to all routes without their own limit. A nil Limit only limits routes with their own limit
+	Limit *RateLimit
+	// Key identifies the client of a request. Defaults to RateLimitByIP
+	Key func(req *http.Request) string
+	// Store keeps the counters. Defaults to an in-memory store
+	Store IRateLimitStore
+}
+
+// RateLimiter is a Middleware that limits the number of requests per client. Rejected requests are answered
+// with 429 too many requests
+type RateLimiter struct {
+	Middleware
+	config *RateLimitConfig
+}
+
+// NewRateLimiter creates a new rate limiting Middleware. A nil config uses the default settings
+func NewRateLimiter(config *RateLimitConfig) *RateLimiter {
+	if config == nil {
+		config = &RateLimitConfig{}
+	}
+
+	if config.Key == nil {
+		config.Key = RateLimitByIP
+	}
+
+	if config.Store == nil {
+		config.Store = NewMemoryRateLimitStore()
+	}
+
+	return &RateLimiter{config: config}
+}
+
+// RateLimitByIP identifies clients by their ip address
+func RateLimitByIP(req *http.Request) string {
+	return "ip:" + ClientIP(req)
+}
+
+// RateLimitBySession identifies clients by the user token of their session cookie and falls back to the ip
+// address. Cookies failing the verification are ignored as clients could evade the limit by sending random values
+func RateLimitBySession(req *http.Request) string {
+	if cookie, err := req.Cookie("AMBER_SESSION"); err == nil && cookie.Value != "" {
+		if cookie = UnlockCookie(cookie); cookie != nil {
+			return "session:" + strings.SplitN(cookie.Value, " ", 2)[0]
+		}
+	}
+	return RateLimitByIP(req)
+}
+
+// RateLimit sets a limit of requests for this route. The route is counted separately from all other routes
+func (r *route) RateLimit(limit int, window time.Duration, algorithm int) *route {
+	r.rateLimit = &RateLimit{Limit: limit, Window: window, Algorithm: algorithm}
+	return r
+}
+
+// WebSocket implements the IWebSocketMiddleware interface
+func (rl *RateLimiter) WebSocket() {}
+
+// Call executes the Middleware
+// Note: Do not call this yourself
+func (rl *RateLimiter) Call(respw http.ResponseWriter, req *http.Request) bool {
+	limit := rl.config.Limit
+	key := rl.config.Key(req)
+
+	if route, ok := context.Get(req, "_Route").(*route); ok && route != nil && route.rateLimit != nil {
+		limit = route.rateLimit
+		key = route.method + " " + route.pattern + " " + key
+	}
+
+	if limit == nil || limit.Limit < 1 || limit.Window <= 0 {
+		return true
+	}
+
+	result, err := rl.config.Store.Take(key, limit, time.Now())
+	if err != nil {
+		// a failing store should not take down the application
+		Log.Errord(JLData{"error": err}, "failed to take rate limit")
+		return true
+	}
+
+	header := respw.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+	if result.Allowed {
+		return true
+	}
+
+	header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+	Log.Warningd(JLData{"key": key, "path": req.URL.Path}, "rate limit exceeded")
+	ErrorHandler(http.StatusTooManyRequests)(respw, req)
+
+	return false
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryRateLimitStore is an IRateLimitStore keeping all counters in memory. Expired counters are removed periodically
+type MemoryRateLimitStore struct {
+	mutex     sync.Mutex
+	entries   map[string]*rateLimitEntry
+	lastSweep time.Time
+}
+
+type rateLimitEntry struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+	// sliding window
+	start    time.Time
+	current  int
+	previous int
+	// expires is the time at which the entry is equivalent to a new one
+	expires time.Time
+}
+
+// NewMemoryRateLimitStore creates a new empty MemoryRateLimitStore
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{entries: make(map[string]*rateLimitEntry)}
+}
+
+// Take implements the IRateLimitStore interface
+func (s *MemoryRateLimitStore) Take(key string, limit *RateLimit, now time.Time) (RateLimitResult, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if now.Sub(s.lastSweep) > time.Minute {
+		s.sweep(now)
+	}
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &rateLimitEntry{tokens: float64(limit.Limit), last: now, start: now}
+		s.entries[key] = entry
+	}
+
+	if limit.Algorithm == RateLimitSlidingWindow {
+		return entry.slidingWindow(limit, now), nil
+	}
+	return entry.tokenBucket(limit, now), nil
+}
+
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func (e *rateLimitEntry) tokenBucket(limit *RateLimit, now time.Time) RateLimitResult {
+	rate := float64(limit.Limit) / float64(limit.Window)
+
+	e.tokens = math.Min(float64(limit.Limit), e.tokens+float64(now.Sub(e.last))*rate)
+	e.last = now
+
+	result := RateLimitResult{Limit: limit.Limit}
+	if e.tokens >= 1 {
+		e.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - e.tokens) / rate)
+	}
+
+	result.Remaining = int(e.tokens)
+	result.Reset = time.Duration((float64(limit.Limit) - e.tokens) / rate)
+	e.expires = now.Add(result.Reset)
+
+	return result
+}
+
+// slidingWindow approximates the number of requests within the last window by weighting the count
+// of the previous fixed window with its overlap
+func (e *rateLimitEntry) slidingWindow(limit *RateLimit, now time.Time) RateLimitResult {
+	if elapsed := now.Sub(e.start); elapsed >= 2*limit.Window {
+		e.start, e.previous, e.current = now, 0, 0
+	} else if elapsed >= limit.Window {
+		e.start, e.previous, e.current = e.start.Add(limit.Window), e.current, 0
+	}
+
+	elapsed := now.Sub(e.start)
+	weight := 1 - float64(elapsed)/float64(limit.Window)
+	count := float64(e.previous)*weight + float64(e.current)
+
+	result := RateLimitResult{Limit: limit.Limit, Reset: limit.Window - elapsed}
+	if count < float64(limit.Limit) {
+		e.current++
+		count++
+		result.Allowed = true
+	} else if e.current >= limit.Limit {
+		// the current window alone exceeds the limit, so wait until its weight has decreased enough
+		result.RetryAfter = limit.Window - elapsed + time.Duration(float64(limit.Window)*(1-float64(limit.Limit)/float64(e.current)))
+	} else {
+		// wait until the weight of the previous window has decreased enough
+		result.RetryAfter = time.Duration(float64(limit.Window)*(1-float64(limit.Limit-e.current)/float64(e.previous))) - elapsed
+	}
+
+	if result.Remaining = limit.Limit - int(math.Ceil(count)); result.Remaining < 0 {
+		result.Remaining = 0
+	}
+
+	// requests of the current window still count during the next one
+	if e.current > 0 {
+		result.Reset += limit.Window
+	}
+	e.expires = e.start.Add(2 * limit.Window)
+
+	return result
+}
@@ -0,0 +1,98 @@
+package jantar
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	j := setupServer(false)
+	j.AddMiddleware(NewRateLimiter(&RateLimitConfig{Limit: &RateLimit{Limit: 2, Window: time.Minute}}))
+	j.AddRoute("GET", "/", helloHandler)
+	j.AddRoute("POST", "/login", helloHandler).RateLimit(1, time.Minute, RateLimitSlidingWindow)
+
+	for i, status := range []int{200, 200, 429} {
+		rw, req := testRequest("GET", "/")
+		req.RemoteAddr = "192.0.2.1:1234"
+		j.ServeHTTP(rw, req)
+
+		assertEqual(status, rw.Code)
+		assertEqual("2", rw.Header().Get("RateLimit-Limit"))
+		if i == 2 {
+			assertEqual("0", rw.Header().Get("RateLimit-Remaining"))
+			assertEqual("30", rw.Header().Get("Retry-After"))
+		}
+	}
+
+	/* routes with their own limit and other clients are counted separately */
+	for _, status := range []int{200, 429} {
+		rw, req := testRequest("POST", "/login")
+		req.RemoteAddr = "192.0.2.1:1234"
+		j.ServeHTTP(rw, req)
+
+		assertEqual(status, rw.Code)
+		assertEqual("1", rw.Header().Get("RateLimit-Limit"))
+	}
+
+	rw, req := testRequest("GET", "/")
+	req.RemoteAddr = "192.0.2.2:1234"
+	j.ServeHTTP(rw, req)
+	assertEqual(200, rw.Code)
+}
+
+func TestRateLimitBySession(t *testing.T) {
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	_, req := testRequest("GET", "/")
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.AddCookie(SecureCookie("user1", "data"))
+	assertEqual("session:user1", RateLimitBySession(req))
+
+	/* forged cookies fall back to the ip address */
+	for _, value := range []string{"random", "user1 4102444800 00 00"} {
+		_, req = testRequest("GET", "/")
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.AddCookie(&http.Cookie{Name: "AMBER_SESSION", Value: value})
+		assertEqual("ip:192.0.2.1", RateLimitBySession(req))
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	now := time.Now()
+
+	assertAllowed := func(expected bool, limit *RateLimit, at time.Duration) {
+		if result, _ := store.Take("key", limit, now.Add(at)); result.Allowed != expected {
+			t.Errorf("Expected request at %v to be allowed: %v, got %v.", at, expected, result.Allowed)
+		}
+	}
+
+	/* token bucket refills evenly */
+	bucket := &RateLimit{Limit: 2, Window: 2 * time.Second, Algorithm: RateLimitTokenBucket}
+	assertAllowed(true, bucket, 0)
+	assertAllowed(true, bucket, 0)
+	assertAllowed(false, bucket, 500*time.Millisecond)
+	assertAllowed(true, bucket, time.Second)
+	assertAllowed(false, bucket, time.Second)
+
+	/* sliding window weights the previous window */
+	store = NewMemoryRateLimitStore()
+	window := &RateLimit{Limit: 2, Window: time.Second, Algorithm: RateLimitSlidingWindow}
+	assertAllowed(true, window, 0)
+	assertAllowed(true, window, 100*time.Millisecond)
+	assertAllowed(false, window, 900*time.Millisecond)
+	assertAllowed(true, window, 1200*time.Millisecond)
+	assertAllowed(false, window, 1300*time.Millisecond)
+	assertAllowed(true, window, 1600*time.Millisecond)
+}
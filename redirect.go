@@ -0,0 +1,98 @@
+package jantar
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidRedirectStatus is returned when redirecting with a status code that is not a redirect
+var ErrInvalidRedirectStatus = errors.New("invalid redirect status code")
+
+// RedirectTo redirects the current request to a given named route using args to complete url variables.
+// The status code is chosen automatically, see RedirectURL
+func (c *Controller) RedirectTo(name string, args ...interface{}) error {
+	return c.RedirectToStatus(0, name, args...)
+}
+
+// RedirectToStatus is equivalent to RedirectTo but uses the given status code
+func (c *Controller) RedirectToStatus(status int, name string, args ...interface{}) error {
+	router := GetModule(ModuleRouter).(*router)
+
+	url, err := router.getReverseURL(name, args)
+	if err != nil {
+		return err
+	}
+
+	return c.RedirectURL(url, status)
+}
+
+// RedirectURL redirects the current request to a given url using one of the status codes 301, 302, 303, 307
+// or 308. A status of 0 results in 303 See Other for unsafe methods like POST and 302 Found otherwise
+func (c *Controller) RedirectURL(url string, status int) error {
+	switch status {
+	case 0:
+		status = http.StatusFound
+		if c.Req.Method != "GET" && c.Req.Method != "HEAD" {
+			status = http.StatusSeeOther
+		}
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return ErrInvalidRedirectStatus
+	}
+
+	c.Respw.Header().Set("Location", url)
+	c.Respw.WriteHeader(status)
+
+	return nil
+}
+
+// RedirectReturnTo redirects to a user supplied url like a "return_to" parameter if it points to the same
+// origin or one of the hosts in Config.RedirectHosts. Every other url redirects to fallback instead to
+// prevent open redirects
+func (c *Controller) RedirectReturnTo(target string, fallback string) error {
+	if !isSafeRedirect(c.Req, target) {
+		if target != "" {
+			Log.Warningd(JLData{"IP": ClientIP(c.Req), "target": target}, "prevented open redirect")
+		}
+		target = fallback
+	}
+
+	return c.RedirectURL(target, 0)
+}
+
+func isSafeRedirect(req *http.Request, target string) bool {
+	// browsers treat backslashes like slashes and ignore control characters
+	if target == "" || strings.ContainsAny(target, "\\\t\r\n") {
+		return false
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+
+	// relative path without a host like "/foo" but not "//evil.com"
+	if u.Scheme == "" && u.Host == "" {
+		return strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, RequestHost(req)) {
+		return true
+	}
+
+	if config, ok := GetModule(ModuleConfig).(*Config); ok && config != nil {
+		for _, host := range config.RedirectHosts {
+			if strings.EqualFold(u.Host, host) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,75 @@
+package jantar
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSafeRedirect(t *testing.T) {
+	setupServer(false)
+	GetModule(ModuleConfig).(*Config).RedirectHosts = []string{"trusted.example.com"}
+
+	req, _ := http.NewRequest("GET", "http://localhost/login", nil)
+
+	targets := map[string]bool{
+		"/dashboard":                     true,
+		"/search?q=//evil.com":           true,
+		"http://localhost/profile":       true,
+		"https://trusted.example.com/":   true,
+		"":                               false,
+		"dashboard":                      false,
+		"//evil.com":                     false,
+		"/\\evil.com":                    false,
+		"https://evil.com":               false,
+		"javascript:alert(1)":            false,
+		"https://localhost.evil.com":     false,
+		"https://trusted.example.com@ev": false,
+	}
+
+	for target, expected := range targets {
+		if isSafeRedirect(req, target) != expected {
+			t.Errorf("Expected isSafeRedirect(%q) to be %v.", target, expected)
+		}
+	}
+}
+
+func TestRedirectTo(t *testing.T) {
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	j := setupServer(false)
+	j.AddRoute("GET", "/users/:id/posts/:post", helloHandler).Name("post")
+
+	for _, test := range []struct {
+		method   string
+		status   int
+		name     string
+		err      error
+		expected int
+		location string
+	}{
+		{"POST", 0, "post", nil, http.StatusSeeOther, "/users/5/posts/hello"},
+		{"GET", 0, "post", nil, http.StatusFound, "/users/5/posts/hello"},
+		{"POST", http.StatusTemporaryRedirect, "post", nil, http.StatusTemporaryRedirect, "/users/5/posts/hello"},
+		{"GET", http.StatusMovedPermanently, "Post", nil, http.StatusMovedPermanently, "/users/5/posts/hello"},
+		{"GET", http.StatusOK, "post", ErrInvalidRedirectStatus, http.StatusOK, ""},
+		{"POST", 0, "missing", ErrUnknownRoute, http.StatusOK, ""},
+	} {
+		rw, req := testRequest(test.method, "/")
+		c := &Controller{Respw: rw, Req: req}
+
+		assertEqual(test.err, c.RedirectToStatus(test.status, test.name, 5, "hello"))
+		assertEqual(test.expected, rw.Code)
+		assertEqual(test.location, rw.Header().Get("Location"))
+	}
+
+	/* RedirectTo chooses the status code */
+	rw, req := testRequest("POST", "/")
+	c := &Controller{Respw: rw, Req: req}
+	assertEqual(nil, c.RedirectTo("post", 1, 2))
+	assertEqual(http.StatusSeeOther, rw.Code)
+	assertEqual("/users/1/posts/2", rw.Header().Get("Location"))
+}
@@ -0,0 +1,111 @@
+package jantar
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/tsurai/jantar/context"
+	"net/http"
+)
+
+// RequestIDHeader is the default header carrying the request id
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDConfig configures the RequestID middleware
+type RequestIDConfig struct {
+	// Header is read from the request and set on the response. Defaults to RequestIDHeader
+	Header string
+	// IgnoreIncoming always generates a new id instead of accepting the one sent by the client or a proxy
+	IgnoreIncoming bool
+	// Generate creates new ids. Defaults to 16 random bytes in hex
+	Generate func() string
+}
+
+// RequestID is a Middleware that assigns an id to every request. The id is echoed in the response, can be
+// read with GetRequestID and is added to all messages of the logger returned by Controller.Log
+type RequestID struct {
+	Middleware
+	config *RequestIDConfig
+}
+
+// NewRequestID creates a new request id Middleware. A nil config uses the default settings
+func NewRequestID(config *RequestIDConfig) *RequestID {
+	if config == nil {
+		config = &RequestIDConfig{}
+	}
+
+	if config.Header == "" {
+		config.Header = RequestIDHeader
+	}
+
+	if config.Generate == nil {
+		config.Generate = generateRequestID
+	}
+
+	return &RequestID{config: config}
+}
+
+// Outer implements the IOuterMiddleware interface
+func (r *RequestID) Outer() {}
+
+// Call executes the Middleware
+// Note: Do not call this yourself
+func (r *RequestID) Call(respw http.ResponseWriter, req *http.Request) bool {
+	id := req.Header.Get(r.config.Header)
+	if r.config.IgnoreIncoming || !isValidRequestID(id) {
+		id = r.config.Generate()
+	}
+
+	context.Set(req, "_RequestID", id, true)
+	context.Set(req, "_Logger", Log.WithData(JLData{"request_id": id}), true)
+	respw.Header().Set(r.config.Header, id)
+
+	return true
+}
+
+func generateRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		Log.Fatal("failed to generate request id")
+	}
+	return hex.EncodeToString(buf)
+}
+
+// isValidRequestID only accepts short ids of safe characters so that they can't forge log entries
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// GetRequestID returns the id of a given request or an empty string if the RequestID middleware is not used
+func GetRequestID(req *http.Request) string {
+	if id, ok := context.GetOk(req, "_RequestID"); ok {
+		return id.(string)
+	}
+	return ""
+}
+
+// requestLogger returns the logger of a given request or the global Log
+func requestLogger(req *http.Request) *JLogger {
+	if logger, ok := context.GetOk(req, "_Logger"); ok {
+		return logger.(*JLogger)
+	}
+	return Log
+}
+
+// RequestID returns the id of the current request
+func (c *Controller) RequestID() string {
+	return GetRequestID(c.Req)
+}
+
+// Log returns a logger that adds the request id to every message
+func (c *Controller) Log() *JLogger {
+	return requestLogger(c.Req)
+}
@@ -0,0 +1,46 @@
+package jantar
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var out bytes.Buffer
+	var id string
+
+	j := setupServer(false)
+	j.AddMiddleware(NewRequestID(nil))
+	j.AddRoute("GET", "/", func(rw http.ResponseWriter, r *http.Request) {
+		id = GetRequestID(r)
+		requestLogger(r).Info("hello")
+	})
+
+	Log = NewJLogger(&out, "", LogLevelInfo)
+	defer Log.SetMinLevel(LogLevelPanic)
+
+	/* valid ids are accepted */
+	rw, req := testRequest("GET", "/")
+	req.Header.Set("X-Request-ID", "abc-123")
+	j.ServeHTTP(rw, req)
+
+	if id != "abc-123" || rw.Header().Get("X-Request-ID") != "abc-123" {
+		t.Errorf("Expected request id abc-123, got %s and header %s.", id, rw.Header().Get("X-Request-ID"))
+	}
+
+	/* forged ids are replaced */
+	rw, req = testRequest("GET", "/")
+	req.Header.Set("X-Request-ID", "abc\n[INFO] forged")
+	j.ServeHTTP(rw, req)
+
+	if len(id) != 32 || rw.Header().Get("X-Request-ID") != id {
+		t.Errorf("Expected generated request id, got %s.", id)
+	}
+
+	/* request loggers add the id to every message */
+	if !strings.Contains(out.String(), "request_id="+id) {
+		t.Errorf("Expected log output to contain request id %s, got '%s'.", id, out.String())
+	}
+}
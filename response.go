@@ -0,0 +1,125 @@
+package jantar
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// IResponseWriter is a http.ResponseWriter recording the status code and the number of bytes written
+type IResponseWriter interface {
+	http.ResponseWriter
+	Status() int
+	Size() int64
+	Written() bool
+}
+
+// responseWriter wraps a http.ResponseWriter and records the status code and the number of bytes written
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+// flushWriter, hijackWriter and flushHijackWriter expose http.Flusher and http.Hijacker only if the wrapped
+// http.ResponseWriter supports them, so that handlers can still detect the support with a type assertion
+type flushWriter struct {
+	*responseWriter
+}
+
+type hijackWriter struct {
+	*responseWriter
+}
+
+type flushHijackWriter struct {
+	*responseWriter
+}
+
+func newResponseWriter(respw http.ResponseWriter) IResponseWriter {
+	if rw, ok := respw.(IResponseWriter); ok {
+		return rw
+	}
+
+	rw := &responseWriter{ResponseWriter: respw}
+	_, flusher := respw.(http.Flusher)
+	_, hijacker := respw.(http.Hijacker)
+
+	switch {
+	case flusher && hijacker:
+		return &flushHijackWriter{rw}
+	case flusher:
+		return &flushWriter{rw}
+	case hijacker:
+		return &hijackWriter{rw}
+	}
+	return rw
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(data)
+	w.size += int64(n)
+
+	return n, err
+}
+
+func (w *responseWriter) flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *responseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.status = http.StatusSwitchingProtocols
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (w *flushWriter) Flush() {
+	w.flush()
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+
+func (w *flushHijackWriter) Flush() {
+	w.flush()
+}
+
+func (w *flushHijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+
+// Unwrap returns the original http.ResponseWriter for http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the written status code. Responses without an explicit status code default to 200
+func (w *responseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Size returns the number of body bytes written
+func (w *responseWriter) Size() int64 {
+	return w.size
+}
+
+// Written returns true if the header has already been written
+func (w *responseWriter) Written() bool {
+	return w.status != 0
+}
@@ -1,6 +1,7 @@
 package jantar
 
 import (
+	"errors"
 	"fmt"
 	"github.com/tsurai/jantar/context"
 	"net/http"
@@ -8,14 +9,28 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"time"
 )
 
+// ErrUnknownRoute is returned when reversing a route name that has not been registered
+var ErrUnknownRoute = errors.New("unknown route name")
+
 type route struct {
-	cName   string
-	cAction string
-	pattern string
-	method  string
-	handler http.HandlerFunc
+	name      string
+	cName     string
+	cAction   string
+	pattern   string
+	method    string
+	handler   http.HandlerFunc
+	upload    *UploadConfig
+	rateLimit *RateLimit
+	maxBody   int64
+	timeout   time.Duration
+	cacheTTL  time.Duration
+	security  *SecurityHeaders
+	skipCSRF  bool
+	websocket bool
+	cType     reflect.Type
 }
 
 type rootNode struct {
@@ -48,7 +63,7 @@ func newRouter() *router {
 
 func (r *router) getMethodPathNode(method string) *pathNode {
 	switch strings.ToUpper(method) {
-	case "GET":
+	case "GET", "HEAD":
 		return r.pathRoot.get
 	case "POST":
 		return r.pathRoot.post
@@ -57,13 +72,17 @@ func (r *router) getMethodPathNode(method string) *pathNode {
 	case "DELETE":
 		return r.pathRoot.delete
 	default:
-		return r.pathRoot.get
+		// methods like OPTIONS have no routes and must not fall through to GET
+		return nil
 	}
 }
 
 func (r *router) findPathLeaf(method string, path string) (*pathLeaf, map[string]string) {
 	var variables []string
 	node := r.getMethodPathNode(method)
+	if node == nil {
+		return nil, nil
+	}
 
 	for _, segment := range splitPath(path) {
 		if edge, ok := node.edges[segment]; ok {
@@ -119,6 +138,11 @@ func (r *router) insertPathLeaf(method string, path string) *pathLeaf {
 func (r *router) addRoute(method string, path string, handler interface{}) *route {
 	route := newRoute(strings.ToUpper(method), path, handler)
 
+	if r.getMethodPathNode(method) == nil {
+		Log.Warningd(JLData{"method": method, "path": path}, "failed to add route. Unsupported method")
+		return route
+	}
+
 	node := r.insertPathLeaf(method, path)
 	node.route = route
 
@@ -143,25 +167,25 @@ func (r *router) searchRoute(req *http.Request) *route {
 	return nil
 }
 
-func (r *router) getReverseURL(name string, param []interface{}) string {
+func (r *router) getReverseURL(name string, param []interface{}) (string, error) {
 	route := r.getNamedRoute(name)
 	nParam := len(param)
 
-	if route != nil {
-		i := -1
-		regex := regexp.MustCompile(":[^/]+")
-		url := regex.ReplaceAllStringFunc(route.pattern, func(str string) string {
-			i = i + 1
-			if i < nParam {
-				return fmt.Sprintf("%v", param[i])
-			}
-			return ""
-		})
-
-		return url
+	if route == nil {
+		return "", ErrUnknownRoute
 	}
 
-	return ""
+	i := -1
+	regex := regexp.MustCompile(":[^/]+")
+	url := regex.ReplaceAllStringFunc(route.pattern, func(str string) string {
+		i = i + 1
+		if i < nParam {
+			return fmt.Sprintf("%v", param[i])
+		}
+		return ""
+	})
+
+	return url, nil
 }
 
 func (r *router) getNamedRoute(name string) *route {
@@ -175,12 +199,13 @@ func (r *router) getNamedRoute(name string) *route {
 // Route functions ---------------------------------------------
 func newRoute(method string, pattern string, handler interface{}) *route {
 	var finalFunc http.HandlerFunc
+	var cType reflect.Type
 	cName := ""
 	cAction := ""
 
 	if reflect.TypeOf(handler) == reflect.TypeOf(http.NotFound) {
 		finalFunc = handler.(func(http.ResponseWriter, *http.Request))
-	} else if cType := getControllerType(handler); cType != nil {
+	} else if cType = getControllerType(handler); cType != nil {
 		fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer())
 		if fn == nil {
 			Log.Warning("failed to add route. Can't fetch controller function")
@@ -207,12 +232,23 @@ func newRoute(method string, pattern string, handler interface{}) *route {
 		Log.Warningd(JLData{"type": reflect.TypeOf(handler), "wanted": reflect.TypeOf(http.NotFound)}, "failed to add route. Invalid handler type")
 	}
 
-	return &route{cName, cAction, pattern, method, finalFunc}
+	return &route{cName: cName, cAction: cAction, pattern: pattern, method: method, handler: finalFunc, cType: cType}
 }
 
 func (r *route) Name(name string) {
 	router := GetModule(ModuleRouter).(*router)
 	router.namedRoutes[strings.ToLower(name)] = r
+	r.name = name
+}
+
+// label returns the name, the controller action or the pattern of the route, whichever is available first
+func (r *route) label() string {
+	if r.name != "" {
+		return r.name
+	} else if r.cName != "" {
+		return r.cName + "#" + r.cAction
+	}
+	return r.pattern
 }
 
 // Helper functions ---------------------------------------------
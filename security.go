@@ -0,0 +1,204 @@
+package jantar
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/tsurai/jantar/context"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecurityHeaders describes the security related header sent with every response except websocket upgrades.
+// Empty values are not sent
+type SecurityHeaders struct {
+	// HSTSMaxAge enables Strict-Transport-Security for responses sent over tls. Zero disables the header
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubDomains bool
+	// HSTSPreload requests the inclusion in the browsers preload lists. Requires HSTSIncludeSubDomains and a
+	// HSTSMaxAge of at least one year
+	HSTSPreload bool
+	// ContentSecurityPolicy e.g. "default-src 'self'"
+	ContentSecurityPolicy string
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only
+	CSPReportOnly bool
+	// CSPNonce adds a nonce generated for every request to the script-src and style-src directives. Missing
+	// directives are added with the sources of default-src. Templates can access the nonce with cspNonce
+	CSPNonce bool
+	// FrameOptions is sent as X-Frame-Options, e.g. "sameorigin" or "deny"
+	FrameOptions string
+	// XSSProtection is sent as X-XSS-Protection. The header is deprecated and ignored by modern browsers
+	XSSProtection string
+	// NoSniff sends X-Content-Type-Options: nosniff
+	NoSniff bool
+	// ReferrerPolicy e.g. "strict-origin-when-cross-origin"
+	ReferrerPolicy string
+	// PermissionsPolicy e.g. "geolocation=(), camera=()"
+	PermissionsPolicy string
+	// CrossOriginOpenerPolicy e.g. "same-origin"
+	CrossOriginOpenerPolicy string
+	// CrossOriginEmbedderPolicy e.g. "require-corp"
+	CrossOriginEmbedderPolicy string
+	// CrossOriginResourcePolicy e.g. "same-origin"
+	CrossOriginResourcePolicy string
+}
+
+// DefaultSecurityHeaders returns the header used if Config.SecurityHeaders is nil. Modify the returned value to
+// extend the defaults
+func DefaultSecurityHeaders() *SecurityHeaders {
+	return &SecurityHeaders{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubDomains: true,
+		FrameOptions:          "sameorigin",
+		XSSProtection:         "1;mode=block",
+		NoSniff:               true,
+	}
+}
+
+// SecurityHeaders replaces the global security header for this route
+func (r *route) SecurityHeaders(headers *SecurityHeaders) *route {
+	r.security = headers
+	return r
+}
+
+// apply sets the security header of a response. HSTS is only sent if the client connected with tls as
+// browsers ignore it otherwise
+func (s *SecurityHeaders) apply(respw http.ResponseWriter, req *http.Request) {
+	header := respw.Header()
+
+	if s.HSTSMaxAge > 0 && RequestScheme(req) == "https" {
+		hsts := "max-age=" + strconv.FormatInt(int64(s.HSTSMaxAge/time.Second), 10)
+		if s.HSTSIncludeSubDomains {
+			hsts += "; includeSubDomains"
+		}
+		if s.HSTSPreload {
+			hsts += "; preload"
+		}
+		header.Set("Strict-Transport-Security", hsts)
+	}
+
+	if policy := s.ContentSecurityPolicy; policy != "" {
+		if s.CSPNonce {
+			nonce := generateNonce()
+			context.Set(req, "_CSPNonce", nonce, true)
+			policy = addNonce(policy, nonce)
+		}
+
+		if s.CSPReportOnly {
+			header.Set("Content-Security-Policy-Report-Only", policy)
+		} else {
+			header.Set("Content-Security-Policy", policy)
+		}
+	}
+
+	if s.NoSniff {
+		header.Set("X-Content-Type-Options", "nosniff")
+	}
+
+	for name, value := range map[string]string{
+		"X-Frame-Options":              s.FrameOptions,
+		"X-XSS-Protection":             s.XSSProtection,
+		"Referrer-Policy":              s.ReferrerPolicy,
+		"Permissions-Policy":           s.PermissionsPolicy,
+		"Cross-Origin-Opener-Policy":   s.CrossOriginOpenerPolicy,
+		"Cross-Origin-Embedder-Policy": s.CrossOriginEmbedderPolicy,
+		"Cross-Origin-Resource-Policy": s.CrossOriginResourcePolicy,
+	} {
+		if value != "" {
+			header.Set(name, value)
+		}
+	}
+}
+
+func generateNonce() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		Log.Fatal("failed to generate csp nonce")
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// addNonce adds the nonce to all directives controlling scripts and styles. Scripts and styles without their
+// own directive fall back to default-src, so the missing directives are added with its sources
+func addNonce(policy string, nonce string) string {
+	var directives [][]string
+	var fallback []string
+	found := make(map[string]bool)
+	source := "'nonce-" + nonce + "'"
+
+	for _, directive := range strings.Split(policy, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) == 0 {
+			continue
+		}
+
+		name := strings.ToLower(fields[0])
+		switch name {
+		case "default-src":
+			fallback = fields[1:]
+		case "script-src", "script-src-elem", "style-src", "style-src-elem":
+			fields = appendSource(fields, source)
+			found[name] = true
+		}
+		directives = append(directives, fields)
+	}
+
+	if fallback != nil {
+		for _, name := range []string{"script-src", "style-src"} {
+			if !found[name] {
+				directives = append(directives, appendSource(append([]string{name}, fallback...), source))
+			}
+		}
+	}
+
+	var result []string
+	for _, fields := range directives {
+		result = append(result, strings.Join(fields, " "))
+	}
+	return strings.Join(result, "; ")
+}
+
+// appendSource adds a source to a directive. 'none' can't be combined with other sources
+func appendSource(fields []string, source string) []string {
+	if len(fields) == 2 && strings.EqualFold(fields[1], "'none'") {
+		fields = fields[:1]
+	}
+	return append(fields[:len(fields):len(fields)], source)
+}
+
+// CSPNonce returns the nonce of the Content-Security-Policy of a request or an empty string if there is none.
+// Responses of requests whose nonce has been used are not cached
+func CSPNonce(req *http.Request) string {
+	if nonce, ok := context.GetOk(req, "_CSPNonce"); ok {
+		context.Set(req, "_CSPNonceUsed", true, true)
+		return nonce.(string)
+	}
+	return ""
+}
+
+// CSPNonce returns the nonce of the Content-Security-Policy of the current request
+func (c *Controller) CSPNonce() string {
+	return CSPNonce(c.Req)
+}
+
+// cspBeforeRenderHook lets templates and the markup injected by the framework use the nonce of the request. The
+// functions are bound to the private template copy of the render and only mark the nonce as used when called
+func cspBeforeRenderHook(req *http.Request, tm *TemplateManager, tmpl *template.Template, args map[string]interface{}) {
+	tmpl.Funcs(template.FuncMap{
+		"cspNonce": func() string {
+			return CSPNonce(req)
+		},
+		"antiClickjacking": func() template.HTML {
+			return antiClickjackingStyle(CSPNonce(req))
+		},
+	})
+}
+
+func antiClickjackingStyle(nonce string) template.HTML {
+	if nonce != "" {
+		return template.HTML("<style id=\"antiClickjack\" nonce=\"" + template.HTMLEscapeString(nonce) + "\">body{display:none !important;}</style>")
+	}
+	return template.HTML("<style id=\"antiClickjack\">body{display:none !important;}</style>")
+}
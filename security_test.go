@@ -0,0 +1,119 @@
+package jantar
+
+import (
+	"crypto/tls"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	j := setupServer(false)
+	j.AddRoute("GET", "/", helloHandler)
+
+	/* defaults, HSTS only over tls */
+	rw, req := testRequest("GET", "/")
+	j.ServeHTTP(rw, req)
+	assertEqual("", rw.Header().Get("Strict-Transport-Security"))
+	assertEqual("sameorigin", rw.Header().Get("X-Frame-Options"))
+	assertEqual("nosniff", rw.Header().Get("X-Content-Type-Options"))
+
+	rw, req = testRequest("GET", "/")
+	req.TLS = &tls.ConnectionState{}
+	j.ServeHTTP(rw, req)
+	assertEqual("max-age=31536000; includeSubDomains", rw.Header().Get("Strict-Transport-Security"))
+
+	/* custom policy and route overrides */
+	j.config.SecurityHeaders = &SecurityHeaders{
+		HSTSMaxAge:            2 * 365 * 24 * time.Hour,
+		HSTSIncludeSubDomains: true,
+		HSTSPreload:           true,
+		ContentSecurityPolicy: "default-src 'self'",
+		ReferrerPolicy:        "no-referrer",
+		NoSniff:               true,
+	}
+	j.AddRoute("GET", "/embed", helloHandler).SecurityHeaders(&SecurityHeaders{CrossOriginResourcePolicy: "cross-origin"})
+
+	rw, req = testRequest("GET", "/")
+	req.TLS = &tls.ConnectionState{}
+	j.ServeHTTP(rw, req)
+	assertEqual("max-age=63072000; includeSubDomains; preload", rw.Header().Get("Strict-Transport-Security"))
+	assertEqual("default-src 'self'", rw.Header().Get("Content-Security-Policy"))
+	assertEqual("no-referrer", rw.Header().Get("Referrer-Policy"))
+	assertEqual("", rw.Header().Get("X-XSS-Protection"))
+
+	rw, req = testRequest("GET", "/embed")
+	j.ServeHTTP(rw, req)
+	assertEqual("cross-origin", rw.Header().Get("Cross-Origin-Resource-Policy"))
+	assertEqual("", rw.Header().Get("Content-Security-Policy"))
+	assertEqual("", rw.Header().Get("X-Content-Type-Options"))
+}
+
+func TestCSPNonce(t *testing.T) {
+	var wg sync.WaitGroup
+	nonceRegexp := regexp.MustCompile(`'nonce-([A-Za-z0-9_-]+)'`)
+
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	/* missing script and style directives are added with the sources of default-src */
+	assertEqual("default-src 'self'; script-src 'self' 'nonce-abc'; style-src 'nonce-abc'",
+		addNonce("default-src 'self'; script-src 'self'; style-src", "abc"))
+	assertEqual("default-src 'self'; script-src 'self' 'nonce-abc'; style-src 'self' 'nonce-abc'",
+		addNonce("default-src 'self'; script-src 'self'", "abc"))
+	assertEqual("default-src 'none'; img-src *; script-src 'nonce-abc'; style-src 'nonce-abc'",
+		addNonce("default-src 'none'; img-src *", "abc"))
+	assertEqual("img-src *", addNonce("img-src *;", "abc"))
+
+	j := setupServer(false)
+	j.config.SecurityHeaders = &SecurityHeaders{ContentSecurityPolicy: "script-src 'self'", CSPNonce: true}
+
+	setupTemplate(j, "index.html", "<html><head>{{antiClickjacking}}</head><script nonce=\"{{cspNonce}}\"></script></html>")
+	j.AddRoute("GET", "/", func(rw http.ResponseWriter, r *http.Request) {
+		if err := j.tm.RenderTemplate(rw, r, "index.html", nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	/* the csrf meta tag, the anti-clickjacking style and the template use the nonce of their own request */
+	nonces := make(chan string, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			rw, req := testRequest("GET", "/")
+			j.ServeHTTP(rw, req)
+
+			match := nonceRegexp.FindStringSubmatch(rw.Header().Get("Content-Security-Policy"))
+			if match == nil || strings.Count(rw.Body.String(), "nonce=\""+match[1]+"\"") != 3 {
+				t.Errorf("Expected the nonce of %v, got %v.", rw.Header().Get("Content-Security-Policy"), rw.Body.String())
+				return
+			}
+			nonces <- match[1]
+		}()
+	}
+
+	wg.Wait()
+	close(nonces)
+
+	/* every request gets a new nonce */
+	seen := make(map[string]bool)
+	for nonce := range nonces {
+		assertEqual(22, len(nonce))
+		assertEqual(false, seen[nonce])
+		seen[nonce] = true
+	}
+}
@@ -0,0 +1,172 @@
+package jantar
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tsurai/jantar/context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventStream error codes
+var (
+	ErrStreamUnsupported = errors.New("response writer does not support flushing")
+	ErrStreamClosed      = errors.New("event stream closed")
+)
+
+// DefaultHeartbeat is the idle time after which an EventStream sends a comment to keep the connection alive
+var DefaultHeartbeat = 15 * time.Second
+
+// Event is a single Server-Sent Event. Empty fields are omitted
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// EventStream sends Server-Sent Events to the client. It is closed when the client disconnects, the
+// server is stopped or the route handler has returned
+type EventStream struct {
+	mutex     sync.Mutex
+	respw     http.ResponseWriter
+	flusher   http.Flusher
+	heartbeat *time.Timer
+	interval  time.Duration
+	done      chan struct{}
+	closed    bool
+}
+
+// EventStream sets the required headers and returns a new EventStream for the current request
+func (c *Controller) EventStream() (*EventStream, error) {
+	flusher, ok := c.Respw.(http.Flusher)
+	if !ok {
+		return nil, ErrStreamUnsupported
+	}
+
+	header := c.Respw.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Respw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	s := &EventStream{respw: c.Respw, flusher: flusher, interval: DefaultHeartbeat, done: make(chan struct{})}
+	s.heartbeat = time.AfterFunc(s.interval, s.sendHeartbeat)
+
+	var stopping <-chan struct{}
+	if ch, ok := context.GetOk(c.Req, "_Stopping"); ok {
+		stopping = ch.(chan struct{})
+	}
+
+	go func() {
+		select {
+		case <-c.Req.Context().Done():
+		case <-stopping:
+		case <-s.done:
+		}
+		s.Close()
+	}()
+
+	context.Set(c.Req, "_EventStream", s, true)
+
+	return s, nil
+}
+
+// SetHeartbeat changes the idle time after which a heartbeat is sent. A value smaller than 1 disables heartbeats
+func (s *EventStream) SetHeartbeat(interval time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.interval = interval
+	s.heartbeat.Stop()
+	if interval > 0 && !s.closed {
+		s.heartbeat.Reset(interval)
+	}
+}
+
+// Send writes an event to the client and flushes it immediately
+func (s *EventStream) Send(e *Event) error {
+	var out string
+
+	if e.ID != "" {
+		out += "id: " + stripNewlines(e.ID) + "\n"
+	}
+
+	if e.Event != "" {
+		out += "event: " + stripNewlines(e.Event) + "\n"
+	}
+
+	if e.Retry > 0 {
+		out += fmt.Sprintf("retry: %d\n", e.Retry/time.Millisecond)
+	}
+
+	for _, line := range strings.Split(strings.Replace(e.Data, "\r\n", "\n", -1), "\n") {
+		out += "data: " + line + "\n"
+	}
+
+	return s.write(out + "\n")
+}
+
+// Done returns a channel that is closed when the stream has been closed
+func (s *EventStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close closes the stream. Handler should return after the stream has been closed
+func (s *EventStream) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closeLocked()
+}
+
+func (s *EventStream) closeLocked() {
+	if !s.closed {
+		s.closed = true
+		s.heartbeat.Stop()
+		close(s.done)
+	}
+}
+
+func (s *EventStream) sendHeartbeat() {
+	s.write(": heartbeat\n\n")
+}
+
+func (s *EventStream) write(data string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return ErrStreamClosed
+	}
+
+	// every write resets the idle timer
+	s.heartbeat.Stop()
+
+	if _, err := s.respw.Write([]byte(data)); err != nil {
+		s.closeLocked()
+		return err
+	}
+	s.flusher.Flush()
+
+	if s.interval > 0 {
+		s.heartbeat.Reset(s.interval)
+	}
+
+	return nil
+}
+
+// closeEventStream closes the EventStream of a finished request
+func closeEventStream(req *http.Request) {
+	if s, ok := context.GetOk(req, "_EventStream"); ok {
+		s.(*EventStream).Close()
+	}
+}
+
+func stripNewlines(str string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(str)
+}
@@ -0,0 +1,140 @@
+package jantar
+
+import (
+	stdcontext "context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// plainWriter hides the optional interfaces of the wrapped http.ResponseWriter
+type plainWriter struct {
+	http.ResponseWriter
+}
+
+func TestEventStream(t *testing.T) {
+	assertEqual := func(expected, got interface{}) {
+		if expected != got {
+			t.Errorf("Expected %v, got %v.", expected, got)
+		}
+	}
+
+	rw, req := testRequest("GET", "/events")
+	c := &Controller{Respw: rw, Req: req}
+
+	stream, err := c.EventStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual("text/event-stream", rw.Header().Get("Content-Type"))
+	assertEqual("no-cache", rw.Header().Get("Cache-Control"))
+	assertEqual(true, rw.Flushed)
+
+	/* event framing */
+	stream.Send(&Event{Data: "hello"})
+	stream.Send(&Event{ID: "1\n2", Event: "update", Retry: 3 * time.Second, Data: "line1\r\nline2"})
+	stream.Close()
+
+	assertEqual("data: hello\n\nid: 12\nevent: update\nretry: 3000\ndata: line1\ndata: line2\n\n", rw.Body.String())
+	assertEqual(ErrStreamClosed, stream.Send(&Event{Data: "closed"}))
+}
+
+func TestEventStreamHeartbeat(t *testing.T) {
+	rw, req := testRequest("GET", "/events")
+	c := &Controller{Respw: rw, Req: req}
+
+	stream, err := c.EventStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream.SetHeartbeat(5 * time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	stream.Close()
+
+	if !strings.HasPrefix(rw.Body.String(), ": heartbeat\n\n") {
+		t.Errorf("Expected heartbeat, got %v.", rw.Body.String())
+	}
+}
+
+func TestEventStreamDisconnect(t *testing.T) {
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+
+	rw, req := testRequest("GET", "/events")
+	c := &Controller{Respw: rw, Req: req.WithContext(ctx)}
+
+	stream, err := c.EventStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* the stream is closed as soon as the client disconnects */
+	cancel()
+
+	select {
+	case <-stream.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Expected stream to be closed.")
+	}
+
+	if err := stream.Send(&Event{Data: "gone"}); err != ErrStreamClosed {
+		t.Errorf("Expected %v, got %v.", ErrStreamClosed, err)
+	}
+}
+
+func TestEventStreamUnsupported(t *testing.T) {
+	rw, req := testRequest("GET", "/events")
+
+	/* wrapping must not add support for flushing */
+	for _, respw := range []http.ResponseWriter{plainWriter{rw}, newResponseWriter(plainWriter{rw})} {
+		c := &Controller{Respw: respw, Req: req}
+		if _, err := c.EventStream(); err != ErrStreamUnsupported {
+			t.Errorf("Expected %v, got %v.", ErrStreamUnsupported, err)
+		}
+	}
+
+	if _, ok := newResponseWriter(plainWriter{rw}).(http.Hijacker); ok {
+		t.Errorf("Expected wrapped writer to not support hijacking.")
+	}
+
+	if _, ok := newResponseWriter(rw).(http.Flusher); !ok {
+		t.Errorf("Expected wrapped writer to support flushing.")
+	}
+}
+
+type streamController struct {
+	Controller
+}
+
+func (c *streamController) Events() {
+	stream, err := c.EventStream()
+	if err != nil {
+		c.Respw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	stream.SetHeartbeat(time.Millisecond)
+	stream.Send(&Event{Data: "hello"})
+	time.Sleep(5 * time.Millisecond)
+}
+
+func TestEventStreamCompression(t *testing.T) {
+	j := setupServer(false)
+	j.AddMiddleware(NewCompression(nil))
+	j.AddRoute("GET", "/events", (*streamController).Events).Timeout(-1)
+
+	/* heartbeats must not write to the compressor after it has been closed */
+	for i := 0; i < 10; i++ {
+		rw, req := testRequest("GET", "/events")
+		req.Header.Set("Accept-Encoding", "gzip")
+		j.ServeHTTP(rw, req)
+
+		if rw.Code != http.StatusOK {
+			t.Errorf("Expected %v, got %v.", http.StatusOK, rw.Code)
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+}
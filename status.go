@@ -2,6 +2,7 @@ package jantar
 
 import (
 	"net/http"
+	"strconv"
 )
 
 // StatusHandler is a map containing a http.HandlerFunc for each client side http status code. This allows
@@ -29,22 +30,31 @@ func init() {
 		http.StatusRequestedRangeNotSatisfiable: "416 requested range not satisfiable",
 		http.StatusExpectationFailed:            "417 expectation failed",
 		http.StatusTeapot:                       "418 teapot",
+		http.StatusTooManyRequests:              "429 too many requests",
+		http.StatusServiceUnavailable:           "503 service unavailable",
+		http.StatusGatewayTimeout:               "504 gateway timeout",
 	}
 
 	StatusHandler = make(map[int]func(http.ResponseWriter, *http.Request))
 	for status, response := range statusResponse {
-		response := response
+		status := status
+		key := "status." + strconv.Itoa(status)
+
+		// the english responses are used if no catalog contains a translation
+		defaultMessages[key] = response
 
 		StatusHandler[status] = func(respw http.ResponseWriter, req *http.Request) {
-			Log.Warning(response)
-			respw.Write([]byte(response))
+			Log.Warning(defaultMessages[key])
+			respw.WriteHeader(status)
+			respw.Write([]byte(translateRequest(req, key)))
 		}
 	}
 }
 
 // ErrorHandler returns a http.HandlerFunc for a given http status code or nil if no handler can be found for that code.
 // Developer can add their own handler by changing the StatusHandler map.
-// Note that only 4xx codes are handled by default as 1xx, 2xx and 3xx are no error codes and 5xx should not be catchable.
+// Note that only 4xx codes and the 503 and 504 responses of timeouts are handled by default as 1xx, 2xx and 3xx are
+// no error codes and other 5xx should not be catchable.
 func ErrorHandler(status int) func(http.ResponseWriter, *http.Request) {
 	if handler, ok := StatusHandler[status]; ok {
 		return handler
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -28,12 +29,16 @@ type TemplateManager struct {
 	watcher   *fsnotify.Watcher
 	tmplFuncs template.FuncMap
 	tmplList  *template.Template
+	tmplPool  *sync.Pool
 }
 
 func newTemplateManager(directory string) *TemplateManager {
 	funcs := template.FuncMap{
 		"antiClickjacking": func() template.HTML {
-			return template.HTML("<style id=\"antiClickjack\">body{display:none !important;}</style>")
+			return antiClickjackingStyle("")
+		},
+		"cspNonce": func() string {
+			return ""
 		},
 		"set": func(args map[string]interface{}, key string, value interface{}) string {
 			if args != nil {
@@ -53,7 +58,11 @@ func newTemplateManager(directory string) *TemplateManager {
 		},
 		"url": func(name string, args ...interface{}) string {
 			router := GetModule(ModuleRouter).(*router)
-			return router.getReverseURL(name, args)
+			url, err := router.getReverseURL(name, args)
+			if err != nil {
+				Log.Warningd(JLData{"name": name}, "failed to reverse url: unknown route name")
+			}
+			return url
 		},
 		"since": func(t time.Time) string {
 			seconds := int(time.Since(t).Seconds())
@@ -78,45 +87,12 @@ func newTemplateManager(directory string) *TemplateManager {
 			}
 			return "> 1 year ago"
 		},
-		"paginate": func(curPage int, nPages int, offset int, url string) template.HTML {
-			if nPages < 2 {
-				return template.HTML("")
-			}
-
-			result := "<ul class='pagination'>"
-
-			if curPage > 1 {
-				result += fmt.Sprintf("<li><a href='%s/page/first'>&laquo;First</a></li>"+
-					"<li><a href='%[1]s/page/%d'>&laquo;</a></li>", url, curPage-1)
-			}
-
-			if curPage-offset > 1 {
-				result += "<li><span>...</span></li>"
-			}
-
-			for i := curPage - offset; i < curPage+offset+1; i++ {
-				if i > 0 && i <= nPages {
-					if i == curPage {
-						result += fmt.Sprintf("<li class='active'><a href='%s/page/%d'>%[2]d</a></li>", url, i)
-					} else {
-						result += fmt.Sprintf("<li><a href='%s/page/%d'>%[2]d</a></li>", url, i)
-					}
-				}
-			}
-
-			if curPage+offset < nPages {
-				result += "<li><span>...</span></li>"
-			}
-
-			if curPage != nPages {
-				result += fmt.Sprintf("<li><a href='%s/page/%d'>&raquo;</a></li>"+
-					"<li><a href='%[1]s/page/last'>Last&raquo;</a></li>", url, curPage+1)
-			}
-			return template.HTML(result + "</ul>")
-		},
 	}
 
 	tm := &TemplateManager{directory: strings.Replace(strings.ToLower(directory), "\\", "/", -1), tmplFuncs: funcs}
+	tm.tmplFuncs["paginate"] = func(p *Paginator) (template.HTML, error) {
+		return renderPagination(nil, p)
+	}
 
 	// register hooks
 	tm.registerHook(TmBeforeParse, reflect.TypeOf(
@@ -149,6 +125,12 @@ func (tm *TemplateManager) loadTemplates() error {
 	var templates *template.Template
 	var staticTemplates *template.Template
 
+	// an application without views doesn't need templates
+	if _, err = os.Stat(tm.directory); os.IsNotExist(err) {
+		Log.Warningf("template directory '%s' does not exist", tm.directory)
+		return nil
+	}
+
 	// close watcher if running
 	if tm.watcher != nil {
 		tm.watcher.Close()
@@ -162,6 +144,10 @@ func (tm *TemplateManager) loadTemplates() error {
 
 	// walk resursive through the template directory
 	ret := filepath.Walk(tm.directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
 		static := false
 		path = strings.Replace(strings.ToLower(path), "\\", "/", -1)
 
@@ -232,12 +218,46 @@ func (tm *TemplateManager) loadTemplates() error {
 
 	// no errors occured, override the old list
 	if ret == nil {
-		tm.tmplList = templates
+		tm.setTemplates(templates)
 	}
 
 	return ret
 }
 
+// setTemplates replaces the parsed templates. The parsed templates are never executed themselves so that
+// they can be cloned for every render
+func (tm *TemplateManager) setTemplates(templates *template.Template) {
+	tm.tmplPool = &sync.Pool{New: func() interface{} {
+		clone, err := templates.Clone()
+		if err != nil {
+			Log.Errord(JLData{"error": err}, "failed to clone templates")
+			return nil
+		}
+		return clone
+	}}
+	tm.tmplList = templates
+}
+
+// acquireTemplates returns a private copy of all templates. Hooks may change the template functions of the
+// copy for a single render without affecting concurrent renders. The copy has to be returned with
+// releaseTemplates
+func (tm *TemplateManager) acquireTemplates() *template.Template {
+	if tm.tmplPool == nil {
+		return nil
+	}
+
+	templates, _ := tm.tmplPool.Get().(*template.Template)
+	return templates
+}
+
+func (tm *TemplateManager) releaseTemplates(templates *template.Template) {
+	if templates != nil && tm.tmplPool != nil {
+		tm.tmplPool.Put(templates)
+	}
+}
+
+// getTemplate returns the parsed template with the given name. The template must not be executed, use
+// acquireTemplates for rendering instead
 func (tm *TemplateManager) getTemplate(name string) *template.Template {
 	if tm.tmplList == nil {
 		return nil
@@ -255,7 +275,16 @@ func (tm *TemplateManager) AddTmplFunc(name string, fn interface{}) {
 // RenderTemplate renders a template with the given name and arguments.
 // Note: A Controller should call its Render function instead.
 func (tm *TemplateManager) RenderTemplate(w io.Writer, req *http.Request, name string, args map[string]interface{}) error {
-	tmpl := tm.getTemplate(name)
+	t0 := time.Now()
+
+	templates := tm.acquireTemplates()
+	defer tm.releaseTemplates(templates)
+
+	var tmpl *template.Template
+	if templates != nil {
+		tmpl = templates.Lookup(strings.ToLower(name))
+	}
+
 	if tmpl == nil {
 		return fmt.Errorf("can't find template '%s'", strings.ToLower(name))
 	}
@@ -266,9 +295,17 @@ func (tm *TemplateManager) RenderTemplate(w io.Writer, req *http.Request, name s
 		hook.(func(*http.Request, *TemplateManager, *template.Template, map[string]interface{}))(req, tm, tmpl, args)
 	}
 
+	// the pagination template has to use the functions bound to this copy by the hooks
+	tmpl.Funcs(template.FuncMap{
+		"paginate": func(p *Paginator) (template.HTML, error) {
+			return renderPagination(templates, p)
+		},
+	})
+
 	if err := tmpl.Execute(w, args); err != nil {
 		return fmt.Errorf("failed to render template. Reason: %s", err.Error())
 	}
 
+	getMetrics().observeRender(strings.ToLower(name), time.Since(t0))
 	return nil
 }
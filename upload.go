@@ -0,0 +1,285 @@
+package jantar
+
+import (
+	"bytes"
+	"errors"
+	"github.com/tsurai/jantar/context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Upload error codes
+var (
+	ErrUploadTooLarge    = errors.New("request body too large")
+	ErrUploadInvalidType = errors.New("file type not allowed")
+	ErrUploadMissing     = errors.New("no file uploaded")
+	ErrUploadForbidden   = errors.New("csrf token missing or invalid")
+)
+
+// UploadConfig describes the limits applied to multipart uploads. It can be set globally in Config
+// and overridden for a single route with route.Upload
+type UploadConfig struct {
+	// MaxSize is the maximum size in bytes of the whole request body. Zero only limits the form values
+	// without a file to 10MB in total
+	MaxSize int64
+	// AllowedTypes is a list of mime types like "image/png" or "image/*" the sniffed content of every
+	// uploaded file has to match. An empty list allows every type
+	AllowedTypes []string
+	// TempDir is the directory uploaded files are streamed to. Defaults to os.TempDir()
+	TempDir string
+}
+
+// UploadedFile describes a single file that has been streamed to the temporary upload directory.
+// Files are removed at the end of the request unless they have been moved with MoveTo
+type UploadedFile struct {
+	Field       string
+	Filename    string
+	ContentType string
+	Size        int64
+	path        string
+}
+
+var defaultUploadConfig = &UploadConfig{MaxSize: 32 << 20}
+
+// Open opens the uploaded file for reading
+func (f *UploadedFile) Open() (*os.File, error) {
+	return os.Open(f.path)
+}
+
+// MoveTo moves the uploaded file to a given path. The file won't be removed at the end of the request afterwards
+func (f *UploadedFile) MoveTo(path string) error {
+	if err := os.Rename(f.path, path); err != nil {
+		return err
+	}
+
+	f.path = ""
+	return nil
+}
+
+// Upload returns the first file uploaded with the given form field
+func (c *Controller) Upload(field string) (*UploadedFile, error) {
+	files := c.Uploads(field)
+	if len(files) == 0 {
+		return nil, ErrUploadMissing
+	}
+
+	return files[0], nil
+}
+
+// Uploads returns all files uploaded with the given form field
+func (c *Controller) Uploads(field string) []*UploadedFile {
+	if files, ok := context.GetOk(c.Req, "_Uploads"); ok {
+		return files.(map[string][]*UploadedFile)[field]
+	}
+
+	return nil
+}
+
+// Upload sets the upload limits for this route
+func (r *route) Upload(config *UploadConfig) *route {
+	r.upload = config
+	return r
+}
+
+func isMultipart(req *http.Request) bool {
+	mediatype, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediatype == "multipart/form-data"
+}
+
+func isAllowedType(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	mediatype, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, a := range allowed {
+		if a == mediatype || (strings.HasSuffix(a, "/*") && strings.HasPrefix(mediatype, a[:len(a)-1])) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseUpload streams all files of a multipart request into the temporary upload directory and fills
+// the form values of req. The csrf token is verified before the first file is stored if the protection is
+// enabled. It responds with 400, 413 or 415 and returns false if the request violates the limits.
+func parseUpload(respw http.ResponseWriter, req *http.Request, config *UploadConfig, protection *csrf) bool {
+	if !isMultipart(req) {
+		return true
+	}
+
+	if config == nil {
+		config = defaultUploadConfig
+	}
+
+	var status int
+	files, values, err := streamUpload(respw, req, config, protection)
+	context.Set(req, "_Uploads", files, true)
+
+	switch err {
+	case nil:
+		req.MultipartForm = &multipart.Form{Value: values}
+		req.PostForm = url.Values(values)
+		req.Form = req.URL.Query()
+		for key, value := range values {
+			req.Form[key] = append(req.Form[key], value...)
+		}
+		return true
+	case ErrUploadTooLarge:
+		status = http.StatusRequestEntityTooLarge
+	case ErrUploadInvalidType:
+		status = http.StatusUnsupportedMediaType
+	default:
+		status = http.StatusBadRequest
+	}
+
+	Log.Warningd(JLData{"error": err, "path": req.URL.Path}, "rejected upload")
+	ErrorHandler(status)(respw, req)
+
+	return false
+}
+
+func streamUpload(respw http.ResponseWriter, req *http.Request, config *UploadConfig, protection *csrf) (map[string][]*UploadedFile, map[string][]string, error) {
+	files := make(map[string][]*UploadedFile)
+	values := make(map[string][]string)
+	verified := protection == nil
+
+	// form values are kept in memory and need a limit even if the size of files is unlimited
+	valueLimit := int64(defaultMaxBodySize)
+	if config.MaxSize > 0 {
+		valueLimit = config.MaxSize
+	}
+
+	if config.MaxSize > 0 {
+		if req.ContentLength > config.MaxSize {
+			return files, values, ErrUploadTooLarge
+		}
+		req.Body = http.MaxBytesReader(respw, req.Body, config.MaxSize)
+	}
+
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return files, values, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return files, values, nil
+		} else if err != nil {
+			return files, values, uploadError(err)
+		}
+
+		if part.FileName() == "" {
+			var buf bytes.Buffer
+			n, err := io.Copy(&buf, io.LimitReader(part, valueLimit+1))
+			if err != nil {
+				return files, values, uploadError(err)
+			}
+
+			if valueLimit -= n; valueLimit < 0 {
+				return files, values, ErrUploadTooLarge
+			}
+
+			values[part.FormName()] = append(values[part.FormName()], buf.String())
+			continue
+		}
+
+		if !verified {
+			if !protection.verifyUpload(req, values) {
+				return files, values, ErrUploadForbidden
+			}
+			verified = true
+		}
+
+		file, err := streamFile(part, config)
+		if file != nil {
+			files[file.Field] = append(files[file.Field], file)
+		}
+
+		if err != nil {
+			return files, values, uploadError(err)
+		}
+	}
+}
+
+func streamFile(part *multipart.Part, config *UploadConfig) (*UploadedFile, error) {
+	// sniff the content type from the first 512 bytes instead of trusting the client
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	if !isAllowedType(contentType, config.AllowedTypes) {
+		return nil, ErrUploadInvalidType
+	}
+
+	tmp, err := ioutil.TempFile(config.TempDir, "jantar-upload-")
+	if err != nil {
+		return nil, err
+	}
+	defer tmp.Close()
+
+	file := &UploadedFile{Field: part.FormName(), Filename: part.FileName(), ContentType: contentType, path: tmp.Name()}
+	file.Size, err = io.Copy(tmp, io.MultiReader(bytes.NewReader(head), part))
+
+	return file, err
+}
+
+func uploadError(err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return ErrUploadTooLarge
+	}
+	return err
+}
+
+// cleanupUploads removes all temporary files of a request that haven't been moved
+func cleanupUploads(req *http.Request) {
+	files, ok := context.GetOk(req, "_Uploads")
+	if !ok {
+		return
+	}
+
+	for _, list := range files.(map[string][]*UploadedFile) {
+		for _, file := range list {
+			if file.path != "" {
+				if err := os.Remove(file.path); err != nil {
+					Log.Warningd(JLData{"error": err}, "failed to remove uploaded file")
+				}
+			}
+		}
+	}
+}
+
+func methodOverride(req *http.Request) {
+	if req.Method != "POST" {
+		return
+	}
+
+	// don't parse multipart bodies before the upload limits of the route are known
+	method := req.URL.Query().Get("_method")
+	if mediatype, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediatype == "application/x-www-form-urlencoded" {
+		if value := req.PostFormValue("_method"); value != "" {
+			method = value
+		}
+	}
+
+	if method != "" {
+		req.Method = strings.ToUpper(method)
+	}
+}
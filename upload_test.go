@@ -0,0 +1,177 @@
+package jantar
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+var uploadedPath string
+
+type uploadController struct {
+	Controller
+}
+
+func (c *uploadController) Save() {
+	file, err := c.Upload("file")
+	if err != nil {
+		c.Respw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	uploadedPath = file.path
+	c.Respw.Write([]byte(file.ContentType))
+}
+
+func uploadRequest(t *testing.T, content []byte) *http.Request {
+	var body bytes.Buffer
+
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("title", "test")
+	part, err := writer.CreateFormFile("file", "test.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return req
+}
+
+func TestUpload(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "jantar-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	j := setupServer(false)
+	j.AddRoute("POST", "/upload", (*uploadController).Save).Upload(&UploadConfig{
+		MaxSize:      1024,
+		AllowedTypes: []string{"image/*"},
+		TempDir:      tmpDir,
+	})
+
+	png := append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), make([]byte, 64)...)
+
+	/* valid upload */
+	rw := httptest.NewRecorder()
+	j.ServeHTTP(rw, uploadRequest(t, png))
+	if rw.Code != http.StatusOK || rw.Body.String() != "image/png" {
+		t.Errorf("Expected 200 image/png, got %d %s.", rw.Code, rw.Body.String())
+	}
+
+	if _, err := os.Stat(uploadedPath); !os.IsNotExist(err) {
+		t.Errorf("Expected uploaded file to be removed after the request")
+	}
+
+	/* invalid type */
+	rw = httptest.NewRecorder()
+	j.ServeHTTP(rw, uploadRequest(t, []byte("plain text")))
+	if rw.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected %d, got %d.", http.StatusUnsupportedMediaType, rw.Code)
+	}
+
+	/* body too large */
+	rw = httptest.NewRecorder()
+	j.ServeHTTP(rw, uploadRequest(t, append(png, make([]byte, 2048)...)))
+	if rw.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected %d, got %d.", http.StatusRequestEntityTooLarge, rw.Code)
+	}
+
+	if files, _ := ioutil.ReadDir(tmpDir); len(files) != 0 {
+		t.Errorf("Expected empty upload directory, found %d files.", len(files))
+	}
+}
+
+func TestUploadCSRF(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "jantar-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	j := setupServer(true)
+	j.AddRoute("POST", "/upload", (*uploadController).Save).Upload(&UploadConfig{
+		MaxSize:      1024,
+		AllowedTypes: []string{"image/*"},
+		TempDir:      tmpDir,
+	})
+
+	id := strings.Repeat("a", 64)
+	png := append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), make([]byte, 64)...)
+
+	request := func(content []byte, field string, header string, tokenFirst bool) *http.Request {
+		var body bytes.Buffer
+
+		writer := multipart.NewWriter(&body)
+		if tokenFirst && field != "" {
+			writer.WriteField("_csrf-token", field)
+		}
+		part, _ := writer.CreateFormFile("file", "test.png")
+		part.Write(content)
+		if !tokenFirst && field != "" {
+			writer.WriteField("_csrf-token", field)
+		}
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/upload", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.AddCookie(&http.Cookie{Name: "JANTAR_ID", Value: id})
+		if header != "" {
+			req.Header.Set(CSRFHeader, header)
+		}
+		return req
+	}
+
+	/* the token is checked before a file is processed, an invalid type would be rejected with 415 otherwise */
+	for _, test := range []struct {
+		content    []byte
+		field      string
+		header     string
+		tokenFirst bool
+		status     int
+	}{
+		{png, id, "", true, http.StatusOK},
+		{png, "", id, true, http.StatusOK},
+		{[]byte("plain text"), "", "", true, http.StatusBadRequest},
+		{[]byte("plain text"), "wrong", "", true, http.StatusBadRequest},
+		{[]byte("plain text"), id, "", false, http.StatusBadRequest},
+		{[]byte("plain text"), id, "", true, http.StatusUnsupportedMediaType},
+	} {
+		rw := httptest.NewRecorder()
+		j.ServeHTTP(rw, request(test.content, test.field, test.header, test.tokenFirst))
+		if rw.Code != test.status {
+			t.Errorf("Expected %d, got %d.", test.status, rw.Code)
+		}
+	}
+}
+
+func TestUploadValueLimit(t *testing.T) {
+	var body bytes.Buffer
+
+	j := setupServer(false)
+	j.AddRoute("POST", "/upload", (*uploadController).Save).Upload(&UploadConfig{})
+
+	/* values are limited even without a maximum size */
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("title", strings.Repeat("a", defaultMaxBodySize+1))
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	rw := httptest.NewRecorder()
+	j.ServeHTTP(rw, req)
+	if rw.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected %d, got %d.", http.StatusRequestEntityTooLarge, rw.Code)
+	}
+}
@@ -0,0 +1,418 @@
+package jantar
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/tsurai/jantar/context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket message types
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+)
+
+// WebSocket close codes as defined by RFC 6455
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// WebSocket error codes
+var (
+	ErrWebSocketHandshake = errors.New("invalid websocket handshake")
+	ErrWebSocketClosed    = errors.New("websocket closed")
+)
+
+// DefaultMaxMessageSize is the default limit in bytes for a single incoming WebSocket message
+var DefaultMaxMessageSize int64 = 1 << 20
+
+// WebSocketCloseError is returned by ReadMessage when the peer closed the connection
+type WebSocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *WebSocketCloseError) Error() string {
+	return fmt.Sprintf("websocket closed with code %d: %s", e.Code, e.Reason)
+}
+
+type protocolError struct {
+	code int
+	msg  string
+}
+
+func (e *protocolError) Error() string {
+	return "websocket protocol error: " + e.msg
+}
+
+// WebSocket is a single RFC 6455 connection. ReadMessage answers pings and close frames automatically
+type WebSocket struct {
+	Req            *http.Request
+	MaxMessageSize int64
+	OnPong         func(data []byte)
+	conn           net.Conn
+	reader         *bufio.Reader
+	writeMutex     sync.Mutex
+	closeSent      bool
+}
+
+// WebSocket adds a route that accepts WebSocket connections on the given pattern. WebSocket routes only pass
+// through Middlewares implementing IWebSocketMiddleware. Instead of the csrf protection the Origin is checked
+// against the host and the trusted origins of the csrf middleware if it is enabled.
+func (j *Jantar) WebSocket(pattern string, handler func(*WebSocket)) *route {
+	r := j.router.addRoute("GET", pattern, func(respw http.ResponseWriter, req *http.Request) {
+		if !j.checkOrigin(req) {
+			Log.Errord(JLData{"IP": ClientIP(req), "origin": req.Header.Get("Origin")}, "websocket origin not allowed")
+			ErrorHandler(http.StatusForbidden)(respw, req)
+			return
+		}
+
+		ws, err := upgradeWebSocket(respw, req)
+		if err != nil {
+			Log.Warningd(JLData{"error": err}, "failed to upgrade websocket")
+			return
+		}
+		defer ws.conn.Close()
+
+		done := make(chan struct{})
+		defer close(done)
+
+		go func() {
+			select {
+			case <-j.stopping:
+				ws.Close(CloseGoingAway, "server shutting down")
+				ws.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			case <-done:
+			}
+		}()
+
+		handler(ws)
+		ws.Close(CloseNormal, "")
+	})
+	r.websocket = true
+
+	return r
+}
+
+func (j *Jantar) checkOrigin(req *http.Request) bool {
+	protection := j.getCSRF()
+	origin := req.Header.Get("Origin")
+	if protection == nil || origin == "" {
+		return true
+	}
+
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, RequestHost(req)) {
+		return true
+	}
+
+	return protection.isTrustedOrigin(origin)
+}
+
+func headerContains(header http.Header, name string, value string) bool {
+	for _, v := range header[http.CanonicalHeaderKey(name)] {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func upgradeWebSocket(respw http.ResponseWriter, req *http.Request) (*WebSocket, error) {
+	key := req.Header.Get("Sec-Websocket-Key")
+
+	if req.Method != "GET" || !headerContains(req.Header, "Connection", "upgrade") ||
+		!headerContains(req.Header, "Upgrade", "websocket") || key == "" {
+		ErrorHandler(http.StatusBadRequest)(respw, req)
+		return nil, ErrWebSocketHandshake
+	}
+
+	if req.Header.Get("Sec-Websocket-Version") != "13" {
+		respw.Header().Set("Sec-WebSocket-Version", "13")
+		ErrorHandler(http.StatusBadRequest)(respw, req)
+		return nil, ErrWebSocketHandshake
+	}
+
+	hijacker, ok := respw.(http.Hijacker)
+	if !ok {
+		http.Error(respw, "500 internal server error", 500)
+		return nil, errors.New("response writer does not support hijacking")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n")
+	if err = rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &WebSocket{Req: req, MaxMessageSize: DefaultMaxMessageSize, conn: conn, reader: rw.Reader}, nil
+}
+
+// UrlParam returns the url parameter of the WebSocket route
+func (ws *WebSocket) UrlParam() map[string]string {
+	return context.UrlParam(ws.Req)
+}
+
+// Session returns the unlocked SecureCookie of the client or nil if it has none
+func (ws *WebSocket) Session() *http.Cookie {
+	cookie, err := ws.Req.Cookie("AMBER_SESSION")
+	if err != nil {
+		return nil
+	}
+
+	return UnlockCookie(cookie)
+}
+
+// ReadMessage blocks until a complete text or binary message has been received. Fragmented messages
+// are reassembled. A *WebSocketCloseError is returned once the peer closed the connection
+func (ws *WebSocket) ReadMessage() (int, []byte, error) {
+	var messageType int
+	var message []byte
+
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			if perr, ok := err.(*protocolError); ok {
+				ws.Close(perr.code, perr.msg)
+			}
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err = ws.writeFrame(true, opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			if ws.OnPong != nil {
+				ws.OnPong(payload)
+			}
+			continue
+		case opClose:
+			return 0, nil, ws.handleClose(payload)
+		case opText, opBinary:
+			if messageType != 0 {
+				ws.Close(CloseProtocolError, "expected continuation frame")
+				return 0, nil, ErrWebSocketClosed
+			}
+			messageType = int(opcode)
+		case opContinuation:
+			if messageType == 0 {
+				ws.Close(CloseProtocolError, "unexpected continuation frame")
+				return 0, nil, ErrWebSocketClosed
+			}
+		default:
+			ws.Close(CloseProtocolError, "unknown opcode")
+			return 0, nil, ErrWebSocketClosed
+		}
+
+		if ws.MaxMessageSize > 0 && int64(len(message)+len(payload)) > ws.MaxMessageSize {
+			ws.Close(CloseMessageTooBig, "message too big")
+			return 0, nil, ErrWebSocketClosed
+		}
+		message = append(message, payload...)
+
+		if fin {
+			if messageType == TextMessage && !utf8.Valid(message) {
+				ws.Close(CloseInvalidPayload, "invalid utf-8")
+				return 0, nil, ErrWebSocketClosed
+			}
+			return messageType, message, nil
+		}
+	}
+}
+
+// WriteMessage sends a text or binary message in a single frame
+func (ws *WebSocket) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return errors.New("invalid message type")
+	}
+
+	return ws.writeFrame(true, byte(messageType), data)
+}
+
+// WriteFragmented sends a text or binary message split into frames of at most size bytes
+func (ws *WebSocket) WriteFragmented(messageType int, data []byte, size int) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return errors.New("invalid message type")
+	}
+
+	opcode := byte(messageType)
+	for size > 0 && len(data) > size {
+		if err := ws.writeFrame(false, opcode, data[:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+		opcode = opContinuation
+	}
+
+	return ws.writeFrame(true, opcode, data)
+}
+
+// Ping sends a ping frame. The answer can be received with OnPong
+func (ws *WebSocket) Ping(data []byte) error {
+	return ws.writeFrame(true, opPing, data)
+}
+
+// Close sends a close frame with given code and reason. Further writes will fail
+func (ws *WebSocket) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+
+	return ws.writeFrame(true, opClose, payload)
+}
+
+func (ws *WebSocket) handleClose(payload []byte) error {
+	closeErr := &WebSocketCloseError{Code: CloseNoStatus}
+
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+		ws.writeFrame(true, opClose, payload[:2])
+	} else {
+		ws.writeFrame(true, opClose, nil)
+	}
+
+	return closeErr
+}
+
+func (ws *WebSocket) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7f)
+
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &protocolError{CloseProtocolError, "reserved bits set"}
+	}
+
+	if !masked {
+		return false, 0, nil, &protocolError{CloseProtocolError, "client frames must be masked"}
+	}
+
+	if opcode >= opClose && (!fin || length > 125) {
+		return false, 0, nil, &protocolError{CloseProtocolError, "invalid control frame"}
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if length < 0 || (ws.MaxMessageSize > 0 && length > ws.MaxMessageSize) {
+		return false, 0, nil, &protocolError{CloseMessageTooBig, "frame too big"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+func (ws *WebSocket) writeFrame(fin bool, opcode byte, payload []byte) error {
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+
+	if ws.closeSent {
+		return ErrWebSocketClosed
+	}
+
+	header := make([]byte, 2, 10)
+	header[0] = opcode
+	if fin {
+		header[0] |= 0x80
+	}
+
+	switch length := len(payload); {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		header = header[:4]
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header[1] = 127
+		header = header[:10]
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+
+	if opcode == opClose {
+		ws.closeSent = true
+	}
+
+	if _, err := ws.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+
+	return nil
+}
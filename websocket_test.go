@@ -0,0 +1,203 @@
+package jantar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func writeClientFrame(w io.Writer, fin bool, opcode byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	header := []byte{opcode, 0x80 | byte(len(payload))}
+	if fin {
+		header[0] |= 0x80
+	}
+
+	masked := make([]byte, len(payload))
+	for i := range payload {
+		masked[i] = payload[i] ^ mask[i%4]
+	}
+
+	w.Write(append(append(header, mask...), masked...))
+}
+
+func readServerFrame(t *testing.T, r io.Reader) (byte, []byte) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := make([]byte, header[1]&0x7f)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	return header[0] & 0x0f, payload
+}
+
+func TestWebSocket(t *testing.T) {
+	j := setupServer(true)
+	j.WebSocket("/echo/:name", func(ws *WebSocket) {
+		for {
+			messageType, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			ws.WriteMessage(messageType, append([]byte(ws.UrlParam()["name"]+":"), data...))
+		}
+	})
+
+	server := httptest.NewServer(j)
+	defer server.Close()
+
+	/* foreign origin */
+	req, _ := http.NewRequest("GET", server.URL+"/echo/test", nil)
+	req.Header.Set("Origin", "http://evil.example.com")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected foreign origin to be rejected")
+	}
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	host := server.Listener.Addr().String()
+	io.WriteString(conn, "GET /echo/test HTTP/1.1\r\nHost: "+host+"\r\nOrigin: http://"+host+"\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Expected valid handshake, got %d %s.", resp.StatusCode, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+
+	/* fragmented message with an interleaved ping */
+	writeClientFrame(conn, false, opText, []byte("hel"))
+	writeClientFrame(conn, true, opPing, []byte("ping"))
+	writeClientFrame(conn, true, opContinuation, []byte("lo"))
+
+	if opcode, data := readServerFrame(t, reader); opcode != opPong || string(data) != "ping" {
+		t.Errorf("Expected pong, got %x %s.", opcode, data)
+	}
+
+	if opcode, data := readServerFrame(t, reader); opcode != opText || string(data) != "test:hello" {
+		t.Errorf("Expected text message 'test:hello', got %x %s.", opcode, data)
+	}
+
+	/* close handshake */
+	code := make([]byte, 2)
+	binary.BigEndian.PutUint16(code, CloseNormal)
+	writeClientFrame(conn, true, opClose, code)
+
+	if opcode, data := readServerFrame(t, reader); opcode != opClose || !bytes.Equal(data, code) {
+		t.Errorf("Expected close frame, got %x %v.", opcode, data)
+	}
+
+	if _, err := reader.ReadByte(); err != io.EOF && !strings.Contains(err.Error(), "reset") {
+		t.Errorf("Expected connection to be closed, got %v.", err)
+	}
+
+	// hijacked connections are not tracked by the test server
+	j.wg.Wait()
+}
+
+func TestWebSocketMiddleware(t *testing.T) {
+	var skipped bool
+
+	j := setupServer(false)
+	j.AddMiddleware(NewAuth(&AuthConfig{Bearer: StaticTokens(map[string]interface{}{"token": "service"})}))
+	j.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			skipped = false
+			next.ServeHTTP(rw, r)
+		})
+	})
+	j.WebSocket("/ws", func(ws *WebSocket) {
+		if GetPrincipal(ws.Req) != "service" {
+			t.Errorf("Expected the principal of the upgrade request.")
+		}
+	})
+
+	server := httptest.NewServer(j)
+	defer server.Close()
+
+	host := server.Listener.Addr().String()
+	for token, status := range map[string]int{"wrong": http.StatusUnauthorized, "token": http.StatusSwitchingProtocols} {
+		skipped = true
+
+		conn, err := net.Dial("tcp", host)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: "+host+"\r\nOrigin: http://"+host+"\r\n"+
+			"Authorization: Bearer "+token+"\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+			"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != status {
+			t.Errorf("Expected %v, got %v.", status, resp.StatusCode)
+		}
+		if !skipped {
+			t.Errorf("Expected middlewares modifying the response to be skipped.")
+		}
+	}
+
+	j.wg.Wait()
+}
+
+type yieldWebSocketMiddleware struct {
+	yieldMiddleware
+}
+
+func (m *yieldWebSocketMiddleware) WebSocket() {}
+
+func TestWebSocketPipeline(t *testing.T) {
+	var trace []string
+	marker := false
+
+	j := setupServer(false)
+	j.AddMiddleware(&yieldWebSocketMiddleware{yieldMiddleware{trace: &trace}})
+	j.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			marker = true
+			next.ServeHTTP(rw, r)
+		})
+	})
+	j.AddRoute("GET", "/", helloHandler)
+	j.WebSocket("/ws", func(ws *WebSocket) {})
+
+	/* yielding in the websocket pipeline must not change the pipeline of other routes */
+	for _, path := range []string{"/", "/ws", "/"} {
+		marker = false
+
+		rw, req := testRequest("GET", path)
+		j.ServeHTTP(rw, req)
+
+		if expected := path != "/ws"; marker != expected {
+			t.Errorf("Expected middleware to run on %v to be %v, got %v.", path, expected, marker)
+		}
+	}
+
+	if len(trace) != 6 {
+		t.Errorf("Expected yielding middleware to run for every request, got %v.", trace)
+	}
+}